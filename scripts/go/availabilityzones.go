@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/spf13/cobra"
+
+	"aegis-k8s-framework/zones"
+)
+
+var zonesCmd = &cobra.Command{
+	Use:   "zones",
+	Short: "List the availability zones of the region and check the cluster template against them",
+	Long: `List the availability zones and local zones of the configured region with
+their zone IDs and opt-in status, and check that the zones the cluster
+template hard-codes ({{REGION}}a, b and c) exist and are usable.
+
+Without --live the offline zone catalog bundled with the CLI is used. Zone
+names map to zone IDs differently in every account, so use --live to see the
+mapping of your own account.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+
+		provider, err := zoneProvider(config, zonesLive)
+		if err != nil {
+			log.Fatalf("Failed to load zones: %v", err)
+		}
+		regionZones, err := provider.Zones(config.Region)
+		if err != nil {
+			log.Fatalf("Failed to load zones: %v", err)
+		}
+
+		printZones(os.Stdout, regionZones)
+		if err := checkTemplateZones(provider, config.Region); err != nil {
+			fmt.Printf("\nCluster template zones: FAIL\n%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nCluster template zones: OK (%s)\n", strings.Join(templateZones(config.Region), ", "))
+	},
+}
+
+var zonesLive bool
+
+func init() {
+	zonesCmd.Flags().BoolVar(&zonesLive, "live", false, "Query the EC2 API instead of the offline zone catalog")
+	rootCmd.AddCommand(zonesCmd)
+}
+
+// zoneProvider returns the EC2 API provider when live is set, and the
+// bundled catalog otherwise.
+func zoneProvider(config Config, live bool) (zones.Provider, error) {
+	if live {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		return zones.EC2{Session: sess}, nil
+	}
+	return zones.LoadCatalog("", config.LocalZoneGroups)
+}
+
+// checkZonePlacement stops provisioning when the zone catalog shows that the
+// masters and subnets of the cluster template cannot be placed in the
+// region. Regions missing from the catalog are only warned about.
+func checkZonePlacement(config Config) {
+	catalog, err := zones.LoadCatalog("", config.LocalZoneGroups)
+	if err != nil {
+		log.Fatalf("Failed to load zones: %v", err)
+	}
+	regionZones, err := placementZones(catalog, config.Region)
+	if err == nil {
+		_, err = zones.PlaceMasters(regionZones, len(templateZoneSuffixes))
+	}
+	if err != nil {
+		log.Fatalf("Cannot place the cluster in %s: %v\nCheck the zones of your account with 'aegis zones --live'", config.Region, err)
+	}
+	if _, err := catalog.Zones(config.Region); errors.Is(err, zones.ErrUnknownRegion) {
+		fmt.Printf("Warning: %s is not in the zone catalog; assuming it has the zones %s\n",
+			config.Region, strings.Join(templateZones(config.Region), ", "))
+	}
+}
+
+// templateZonePattern matches the master instance groups the etcd members of
+// the cluster template are pinned to, one per zone; renderSubnets places the
+// subnets in the same zones.
+var templateZonePattern = regexp.MustCompile(`instanceGroup:\s*master-\{\{REGION\}\}([a-z]+)`)
+
+// checkTemplateZones checks that the zones of the cluster template match
+// templateZoneSuffixes and exist in region.
+func checkTemplateZones(provider zones.Provider, region string) error {
+	template, err := os.ReadFile(filepath.Join(kopsDir, "templates", "cluster.yaml.template"))
+	if err != nil {
+		return err
+	}
+
+	var suffixes []string
+	for _, match := range templateZonePattern.FindAllStringSubmatch(string(template), -1) {
+		if !slices.Contains(suffixes, match[1]) {
+			suffixes = append(suffixes, match[1])
+		}
+	}
+	if !slices.Equal(suffixes, templateZoneSuffixes) {
+		return fmt.Errorf("cluster template uses zones %v, the CLI expects %v", suffixes, templateZoneSuffixes)
+	}
+
+	return zones.Require(provider, region, templateZones(region))
+}
+
+func printZones(out io.Writer, regionZones []zones.Zone) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tTYPE\tGROUP\tOPT-IN")
+	for _, zone := range regionZones {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", zone.Name, zone.ID, zone.Type, zone.Group, zone.OptInStatus)
+	}
+	w.Flush()
+}
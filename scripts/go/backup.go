@@ -0,0 +1,540 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	backupManifestFile = "manifest.json"
+
+	// etcdBackupPrefix is where etcd-manager writes its periodic backups
+	// inside the kops state store.
+	etcdBackupPrefix = "backups/etcd/"
+)
+
+// etcdClusters are the etcd clusters defined in the cluster template.
+var etcdClusters = []string{"main", "events"}
+
+// backupTime returns the time a backup is taken at, which names it.
+var backupTime = time.Now
+
+// BackupManifest describes a consistent set of kops state, etcd backups and
+// Terraform state captured by `aegis backup create`.
+type BackupManifest struct {
+	ID             string            `json:"id"`
+	Environment    string            `json:"environment"`
+	ClusterName    string            `json:"clusterName"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	KopsStateStore string            `json:"kopsStateStore"`
+	EtcdBackups    map[string]string `json:"etcdBackups"`
+	Terraform      *TerraformState   `json:"terraform,omitempty"`
+	// Objects maps every key stored in the backup to its SHA-256 checksum.
+	Objects map[string]string `json:"objects"`
+}
+
+// TerraformState records the Terraform state version captured in a backup.
+type TerraformState struct {
+	Serial           int    `json:"serial"`
+	Lineage          string `json:"lineage"`
+	TerraformVersion string `json:"terraformVersion"`
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up and restore kops state, etcd and Terraform state",
+}
+
+var backupCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a backup of the cluster state",
+	Long: `Snapshot the kops state store, collect the latest etcd-manager backup of each
+etcd cluster and record the current Terraform state.
+
+etcd-manager writes a backup to the state store every 15 minutes; the most recent
+one is collected. Use --max-etcd-age to refuse backups that are too old.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+		backups, kopsState := openBackupStores(config)
+
+		manifest, err := createBackup(config, backups, kopsState)
+		if err != nil {
+			log.Fatalf("Backup failed: %v", err)
+		}
+
+		fmt.Printf("Backup %s created in %s (%d objects)\n", manifest.ID, backups.URL(), len(manifest.Objects))
+	},
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available backups",
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+		backups, _ := openBackupStores(config)
+
+		manifests, err := listBackups(backups)
+		if err != nil {
+			log.Fatalf("Failed to list backups: %v", err)
+		}
+		printBackups(os.Stdout, manifests)
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore ID",
+	Short: "Restore the cluster state from a backup",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+		backups, kopsState := openBackupStores(config)
+
+		manifest, err := readBackupManifest(backups, args[0])
+		if err != nil {
+			log.Fatalf("Failed to read backup %s: %v", args[0], err)
+		}
+		if err := checkBackupTarget(config, kopsState, manifest); err != nil {
+			if !backupForce {
+				log.Fatalf("Refusing to restore: %v; pass --force to restore it anyway", err)
+			}
+			fmt.Printf("Warning: %v\n", err)
+		}
+		if err := verifyBackup(backups, manifest); err != nil {
+			log.Fatalf("Backup %s is not consistent: %v", args[0], err)
+		}
+
+		if !backupApply {
+			fmt.Printf("Backup %s verified: %d objects, etcd backups %v\n", manifest.ID, len(manifest.Objects), manifest.EtcdBackups)
+			if backupPrune {
+				stale, err := staleKopsKeys(kopsState, manifest)
+				if err != nil {
+					log.Fatalf("Failed to list kops state: %v", err)
+				}
+				for _, key := range stale {
+					fmt.Printf("Would prune %s\n", key)
+				}
+			}
+			fmt.Println("Run again with --yes to restore it")
+			return
+		}
+
+		if err := restoreBackup(backups, kopsState, manifest); err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		fmt.Printf("Backup %s restored to %s\n", manifest.ID, kopsState.URL())
+		fmt.Println("Roll the control plane to complete the etcd restore: kops rolling-update cluster --name " +
+			manifest.ClusterName + " --instance-group-roles=Master --cloudonly --force --yes")
+	},
+}
+
+var (
+	backupStore      string
+	backupKopsState  string
+	backupApply      bool
+	backupPrune      bool
+	backupForce      bool
+	backupMaxEtcdAge time.Duration
+
+	backupRecordTerraform  bool
+	backupRestoreTerraform bool
+)
+
+func init() {
+	backupCmd.PersistentFlags().StringVar(&backupStore, "store", "",
+		"Backup location as s3://bucket/prefix or file:///path (default s3://<state bucket>/aegis-backups)")
+	backupCmd.PersistentFlags().StringVar(&backupKopsState, "kops-state", "",
+		"kops state store as s3://bucket/prefix or file:///path (default s3://<state bucket>/kops-<environment>)")
+
+	backupCreateCmd.Flags().BoolVar(&backupRecordTerraform, "terraform", true, "Record the Terraform state")
+	backupCreateCmd.Flags().DurationVar(&backupMaxEtcdAge, "max-etcd-age", 0, "Fail if the latest etcd backup is older than this (0 disables the check)")
+
+	backupRestoreCmd.Flags().BoolVar(&backupApply, "yes", false, "Restore the backup (otherwise only verify it)")
+	backupRestoreCmd.Flags().BoolVar(&backupPrune, "prune", false,
+		"Delete kops state objects that are not in the backup, such as instance groups created after it")
+	backupRestoreCmd.Flags().BoolVar(&backupForce, "force", false,
+		"Restore a backup of another environment or kops state store")
+	backupRestoreCmd.Flags().BoolVar(&backupRestoreTerraform, "terraform", false, "Also push the recorded Terraform state")
+
+	backupCmd.AddCommand(backupCreateCmd)
+	backupCmd.AddCommand(backupListCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+	rootCmd.AddCommand(backupCmd)
+}
+
+func openBackupStores(config Config) (ObjectStore, ObjectStore) {
+	backupLocation := backupStore
+	kopsLocation := backupKopsState
+	if backupLocation == "" || kopsLocation == "" {
+		if config.StateBucket == "" {
+			log.Fatal("KOPS_STATE_BUCKET must be set unless --store and --kops-state are given")
+		}
+		if backupLocation == "" {
+			backupLocation = fmt.Sprintf("s3://%s/aegis-backups", config.StateBucket)
+		}
+		if kopsLocation == "" {
+			kopsLocation = fmt.Sprintf("s3://%s/kops-%s", config.StateBucket, config.Environment)
+		}
+	}
+
+	backups, err := openStore(backupLocation, config.Region)
+	if err != nil {
+		log.Fatal(err)
+	}
+	kopsState, err := openStore(kopsLocation, config.Region)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return backups, kopsState
+}
+
+func createBackup(config Config, backups, kopsState ObjectStore) (*BackupManifest, error) {
+	now := backupTime().UTC()
+	manifest := &BackupManifest{
+		ID:             fmt.Sprintf("%s-%s", config.Environment, now.Format("20060102-150405.000")),
+		Environment:    config.Environment,
+		ClusterName:    config.ClusterName,
+		CreatedAt:      now,
+		KopsStateStore: kopsState.URL(),
+		EtcdBackups:    make(map[string]string),
+		Objects:        make(map[string]string),
+	}
+
+	// Never mix the objects of two backups started at the same time
+	existing, err := backups.List(manifest.ID + "/")
+	if err != nil {
+		return nil, fmt.Errorf("listing backups: %w", err)
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("backup %s already exists in %s", manifest.ID, backups.URL())
+	}
+
+	put := func(key string, data []byte) error {
+		sum := sha256.Sum256(data)
+		manifest.Objects[key] = hex.EncodeToString(sum[:])
+		return backups.Put(path.Join(manifest.ID, key), data)
+	}
+
+	keys, err := kopsState.List("")
+	if err != nil {
+		return nil, fmt.Errorf("listing kops state: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("kops state store %s is empty", kopsState.URL())
+	}
+
+	fmt.Printf("Snapshotting kops state from %s...\n", kopsState.URL())
+	for _, key := range keys {
+		// etcd backups are collected separately; copying all of them would
+		// grow every snapshot with the full backup history.
+		if strings.HasPrefix(key, etcdBackupPrefix) {
+			continue
+		}
+		data, err := kopsState.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", key, err)
+		}
+		if err := put(path.Join("kops", key), data); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("Collecting etcd-manager backups...")
+	for _, cluster := range etcdClusters {
+		name, files := latestEtcdBackup(keys, cluster)
+		if name == "" {
+			return nil, fmt.Errorf("no etcd-manager backup found for etcd cluster %s", cluster)
+		}
+		// Backup names start with an RFC 3339 timestamp, e.g. 2023-05-17T12:00:00Z-000001.
+		if backupMaxEtcdAge > 0 && len(name) >= len("2006-01-02T15:04:05Z") {
+			taken, err := time.Parse(time.RFC3339, name[:len("2006-01-02T15:04:05Z")])
+			if err == nil && now.Sub(taken) > backupMaxEtcdAge {
+				return nil, fmt.Errorf("latest %s etcd backup %s is older than %s", cluster, name, backupMaxEtcdAge)
+			}
+		}
+
+		for _, key := range files {
+			data, err := kopsState.Get(key)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", key, err)
+			}
+			if err := put(path.Join("etcd", strings.TrimPrefix(key, etcdBackupPrefix)), data); err != nil {
+				return nil, err
+			}
+		}
+		manifest.EtcdBackups[cluster] = name
+	}
+
+	if backupRecordTerraform {
+		fmt.Println("Recording Terraform state...")
+		cmd := exec.Command("terraform", "state", "pull")
+		cmd.Dir = terraformDir
+		cmd.Stderr = os.Stderr
+		data, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("terraform state pull: %w", err)
+		}
+
+		var state struct {
+			Serial           int    `json:"serial"`
+			Lineage          string `json:"lineage"`
+			TerraformVersion string `json:"terraform_version"`
+		}
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("parsing terraform state: %w", err)
+		}
+		manifest.Terraform = &TerraformState{
+			Serial:           state.Serial,
+			Lineage:          state.Lineage,
+			TerraformVersion: state.TerraformVersion,
+		}
+		if err := put("terraform/terraform.tfstate", data); err != nil {
+			return nil, err
+		}
+	}
+
+	// The manifest is written last so that an interrupted backup is never listed.
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := backups.Put(path.Join(manifest.ID, backupManifestFile), data); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// latestEtcdBackup returns the newest etcd-manager backup of cluster and the
+// keys that belong to it. etcd-manager names backups by timestamp, so the
+// lexically greatest name is the most recent.
+func latestEtcdBackup(keys []string, cluster string) (string, []string) {
+	prefix := etcdBackupPrefix + cluster + "/"
+
+	byName := make(map[string][]string)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		name, _, found := strings.Cut(strings.TrimPrefix(key, prefix), "/")
+		// Skip etcd-manager's control/ directory and loose files.
+		if !found || name == "control" {
+			continue
+		}
+		byName[name] = append(byName[name], key)
+	}
+
+	latest := ""
+	for name := range byName {
+		if name > latest {
+			latest = name
+		}
+	}
+	return latest, byName[latest]
+}
+
+func readBackupManifest(backups ObjectStore, id string) (*BackupManifest, error) {
+	data, err := backups.Get(path.Join(id, backupManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func listBackups(backups ObjectStore) ([]*BackupManifest, error) {
+	keys, err := backups.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []*BackupManifest
+	for _, key := range keys {
+		id, file, found := strings.Cut(key, "/")
+		if !found || file != backupManifestFile {
+			continue
+		}
+		manifest, err := readBackupManifest(backups, id)
+		if err != nil {
+			return nil, fmt.Errorf("reading backup %s: %w", id, err)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].CreatedAt.Before(manifests[j].CreatedAt)
+	})
+	return manifests, nil
+}
+
+// checkBackupTarget checks that the backup was taken of the environment and
+// kops state store it is about to be restored to.
+func checkBackupTarget(config Config, kopsState ObjectStore, manifest *BackupManifest) error {
+	if manifest.Environment != config.Environment {
+		return fmt.Errorf("backup %s is of environment %s, not %s", manifest.ID, manifest.Environment, config.Environment)
+	}
+	if manifest.KopsStateStore != kopsState.URL() {
+		return fmt.Errorf("backup %s was taken from %s, not %s", manifest.ID, manifest.KopsStateStore, kopsState.URL())
+	}
+	return nil
+}
+
+// verifyBackup checks every object of the backup against its recorded
+// checksum, so that a restore never starts from an incomplete set.
+func verifyBackup(backups ObjectStore, manifest *BackupManifest) error {
+	for key, want := range manifest.Objects {
+		data, err := backups.Get(path.Join(manifest.ID, key))
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != want {
+			return fmt.Errorf("checksum mismatch for %s", key)
+		}
+	}
+	for _, cluster := range etcdClusters {
+		if manifest.EtcdBackups[cluster] == "" {
+			return fmt.Errorf("missing etcd backup for cluster %s", cluster)
+		}
+	}
+	return nil
+}
+
+func restoreBackup(backups, kopsState ObjectStore, manifest *BackupManifest) error {
+	keys := make([]string, 0, len(manifest.Objects))
+	for key := range manifest.Objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("Restoring kops state and etcd backups to %s...\n", kopsState.URL())
+	var terraformState []byte
+	for _, key := range keys {
+		data, err := backups.Get(path.Join(manifest.ID, key))
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+
+		section, rest, _ := strings.Cut(key, "/")
+		switch section {
+		case "kops":
+			err = kopsState.Put(rest, data)
+		case "etcd":
+			err = kopsState.Put(etcdBackupPrefix+rest, data)
+		case "terraform":
+			terraformState = data
+		}
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", key, err)
+		}
+	}
+
+	if backupPrune {
+		stale, err := staleKopsKeys(kopsState, manifest)
+		if err != nil {
+			return fmt.Errorf("listing kops state: %w", err)
+		}
+		for _, key := range stale {
+			fmt.Printf("Pruning %s\n", key)
+			if err := kopsState.Delete(key); err != nil {
+				return fmt.Errorf("deleting %s: %w", key, err)
+			}
+		}
+	}
+
+	// etcd-manager restores on the next control plane start once a
+	// restore-backup command is queued in its backup store.
+	for _, cluster := range etcdClusters {
+		backupStoreURL := kopsState.URL() + "/" + etcdBackupPrefix + cluster
+		cmd := exec.Command("etcd-manager-ctl", "--backup-store="+backupStoreURL,
+			"restore-backup", manifest.EtcdBackups[cluster])
+		if !strings.HasPrefix(backupStoreURL, "s3://") {
+			fmt.Printf("Skipping etcd restore command for local store: %s\n", strings.Join(cmd.Args, " "))
+			continue
+		}
+		runCommand(cmd)
+	}
+
+	if backupRestoreTerraform {
+		if terraformState == nil {
+			return fmt.Errorf("backup %s does not contain Terraform state", manifest.ID)
+		}
+		fmt.Printf("Pushing Terraform state serial %d...\n", manifest.Terraform.Serial)
+
+		file, err := os.CreateTemp("", "aegis-*.tfstate")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file.Name())
+		if _, err := file.Write(terraformState); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+
+		cmd := exec.Command("terraform", "state", "push", "-force", file.Name())
+		cmd.Dir = terraformDir
+		runCommand(cmd)
+	}
+
+	return nil
+}
+
+// staleKopsKeys returns the keys of the kops state store that are missing
+// from the backup, so that a restore does not mix kops state from two points
+// in time. etcd-manager backups are left alone, as a backup only holds the
+// latest one of each etcd cluster.
+func staleKopsKeys(kopsState ObjectStore, manifest *BackupManifest) ([]string, error) {
+	keys, err := kopsState.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, etcdBackupPrefix) {
+			continue
+		}
+		if _, ok := manifest.Objects[path.Join("kops", key)]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	return stale, nil
+}
+
+func printBackups(out io.Writer, manifests []*BackupManifest) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tCLUSTER\tOBJECTS\tETCD MAIN\tETCD EVENTS\tTF SERIAL")
+	for _, manifest := range manifests {
+		serial := "-"
+		if manifest.Terraform != nil {
+			serial = fmt.Sprintf("%d", manifest.Terraform.Serial)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			manifest.ID,
+			manifest.CreatedAt.Format(time.RFC3339),
+			manifest.ClusterName,
+			len(manifest.Objects),
+			manifest.EtcdBackups["main"],
+			manifest.EtcdBackups["events"],
+			serial)
+	}
+	w.Flush()
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"aegis-k8s-framework/netmodel"
+)
+
+//go:embed pricing.yaml
+var bundledPricing []byte
+
+// Volume sizes in GiB that kops uses when the cluster spec does not set them.
+const (
+	defaultMasterVolumeSize = 64
+	defaultNodeVolumeSize   = 128
+	defaultEtcdVolumeSize   = 20
+	etcdMembersPerCluster   = 3
+)
+
+const (
+	costCompute      = "Compute"
+	costNetworking   = "Networking"
+	costStorage      = "Storage"
+	costLoadBalancer = "Load balancing"
+)
+
+var costCategories = []string{costCompute, costNetworking, costStorage, costLoadBalancer}
+
+// PricingTable holds the unit prices used for cost estimation.
+type PricingTable struct {
+	Updated        string                   `yaml:"updated"`
+	Currency       string                   `yaml:"currency"`
+	HoursPerMonth  float64                  `yaml:"hoursPerMonth"`
+	SpotPriceRatio float64                  `yaml:"spotPriceRatio"`
+	Regions        map[string]RegionPricing `yaml:"regions"`
+}
+
+// RegionPricing holds the unit prices for one AWS region.
+type RegionPricing struct {
+	Instances                 map[string]float64 `yaml:"instances"`
+	NatGatewayHourly          float64            `yaml:"natGatewayHourly"`
+	NatGatewayPerGB           float64            `yaml:"natGatewayPerGB"`
+	PublicIPv4Hourly          float64            `yaml:"publicIPv4Hourly"`
+	EBSGp3PerGBMonth          float64            `yaml:"ebsGp3PerGBMonth"`
+	NetworkLoadBalancerHourly float64            `yaml:"networkLoadBalancerHourly"`
+	InterfaceEndpointHourly   float64            `yaml:"interfaceEndpointHourly"` // Per endpoint and zone
+}
+
+// CostLineItem is a single priced resource. Min and Max reflect the minimum
+// and maximum sizes of autoscaled instance groups.
+type CostLineItem struct {
+	Category    string
+	Description string
+	Quantity    string
+	MinMonthly  float64
+	MaxMonthly  float64
+}
+
+// CostEstimate is the monthly cost of one rendered configuration.
+type CostEstimate struct {
+	Environment string
+	Region      string
+	Currency    string
+	Items       []CostLineItem
+}
+
+// Total returns the minimum and maximum monthly cost, optionally restricted
+// to a category.
+func (e CostEstimate) Total(category string) (float64, float64) {
+	var min, max float64
+	for _, item := range e.Items {
+		if category == "" || item.Category == category {
+			min += item.MinMonthly
+			max += item.MaxMonthly
+		}
+	}
+	return min, max
+}
+
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Estimate infrastructure cost",
+}
+
+var costEstimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Estimate the monthly cost of the configuration before provisioning",
+	Long: `Estimate the monthly cost of the rendered configuration: instance groups,
+NAT gateways and Elastic IPs (or the VPC endpoints of airgapped clusters), EBS
+volumes and the API load balancer.
+
+Pass --compare with additional config files to compare environments side by side.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pricing, err := loadPricing(costPricingPath)
+		if err != nil {
+			log.Fatalf("Failed to load pricing table: %v", err)
+		}
+
+		// Environment variable overrides only apply to the primary config;
+		// the compared files stand for other environments.
+		configs := []Config{loadConfig()}
+		for _, path := range costCompare {
+			config, err := loadConfigFrom(path, noEnvironment)
+			if err != nil {
+				log.Fatal(err)
+			}
+			configs = append(configs, config)
+		}
+
+		estimates := make([]CostEstimate, 0, len(configs))
+		for _, config := range configs {
+			estimate, err := estimateCost(config, pricing, costNatGB)
+			if err != nil {
+				log.Fatalf("Failed to estimate %s: %v", config.Environment, err)
+			}
+			estimates = append(estimates, estimate)
+		}
+
+		for _, estimate := range estimates {
+			printCostEstimate(os.Stdout, estimate)
+		}
+		if len(estimates) > 1 {
+			printCostComparison(os.Stdout, estimates)
+		}
+		fmt.Printf("\nPrices as of %s. Data transfer, LCUs and support are not included.\n", pricing.Updated)
+	},
+}
+
+var (
+	costPricingPath string
+	costCompare     []string
+	costNatGB       float64
+)
+
+func init() {
+	costEstimateCmd.Flags().StringVar(&costPricingPath, "pricing", "", "Pricing table to use instead of the bundled one")
+	costEstimateCmd.Flags().StringArrayVar(&costCompare, "compare", nil, "Additional config file to compare against (repeatable)")
+	costEstimateCmd.Flags().Float64Var(&costNatGB, "nat-gb", 0, "Expected GB per month processed by the NAT gateways")
+
+	costCmd.AddCommand(costEstimateCmd)
+	rootCmd.AddCommand(costCmd)
+}
+
+func loadPricing(path string) (PricingTable, error) {
+	var pricing PricingTable
+
+	data := bundledPricing
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return pricing, err
+		}
+	}
+
+	if err := yaml.Unmarshal(data, &pricing); err != nil {
+		return pricing, err
+	}
+	if pricing.HoursPerMonth <= 0 {
+		return pricing, fmt.Errorf("hoursPerMonth must be positive")
+	}
+	return pricing, nil
+}
+
+func estimateCost(config Config, pricing PricingTable, natGB float64) (CostEstimate, error) {
+	estimate := CostEstimate{
+		Environment: config.Environment,
+		Region:      config.Region,
+		Currency:    pricing.Currency,
+	}
+
+	prices, ok := pricing.Regions[config.Region]
+	if !ok {
+		return estimate, fmt.Errorf("no pricing for region %s", config.Region)
+	}
+	hours := pricing.HoursPerMonth
+	add := func(category, description, quantity string, min, max float64) {
+		estimate.Items = append(estimate.Items, CostLineItem{
+			Category:    category,
+			Description: description,
+			Quantity:    quantity,
+			MinMonthly:  min,
+			MaxMonthly:  max,
+		})
+	}
+
+	for _, ig := range config.InstanceGroups {
+		hourly, ok := prices.Instances[ig.MachineType]
+		if !ok {
+			return estimate, fmt.Errorf("no pricing for instance type %s in %s", ig.MachineType, config.Region)
+		}
+		lifecycle := "on-demand"
+		if ig.Spot {
+			hourly *= pricing.SpotPriceRatio
+			lifecycle = "spot"
+		}
+		add(costCompute, fmt.Sprintf("%s (%s %s)", ig.Name, ig.MachineType, lifecycle), sizeRange(ig.MinSize, ig.MaxSize),
+			float64(ig.MinSize)*hourly*hours, float64(ig.MaxSize)*hourly*hours)
+
+		volumeSize := ig.RootVolumeSize
+		if volumeSize == 0 {
+			volumeSize = defaultNodeVolumeSize
+			if ig.Role == roleMaster {
+				volumeSize = defaultMasterVolumeSize
+			}
+		}
+		volumeMonthly := float64(volumeSize) * prices.EBSGp3PerGBMonth
+		add(costStorage, fmt.Sprintf("%s root volumes (%d GiB gp3)", ig.Name, volumeSize), sizeRange(ig.MinSize, ig.MaxSize),
+			float64(ig.MinSize)*volumeMonthly, float64(ig.MaxSize)*volumeMonthly)
+	}
+
+	etcdVolumes := len(etcdClusters) * etcdMembersPerCluster
+	etcdMonthly := float64(etcdVolumes*defaultEtcdVolumeSize) * prices.EBSGp3PerGBMonth
+	add(costStorage, fmt.Sprintf("etcd volumes (%d GiB gp3)", defaultEtcdVolumeSize), fmt.Sprintf("%d", etcdVolumes),
+		etcdMonthly, etcdMonthly)
+
+	if config.Airgapped {
+		// terraform/modules/vpc creates the S3 gateway endpoint, which is free,
+		// and an interface endpoint per service in every private subnet.
+		endpoints := len(netmodel.InterfaceEndpointServices) * len(config.PrivateSubnets)
+		endpointMonthly := float64(endpoints) * prices.InterfaceEndpointHourly * hours
+		add(costNetworking, "Interface endpoints", fmt.Sprintf("%d", endpoints), endpointMonthly, endpointMonthly)
+		add(costNetworking, "S3 gateway endpoint", "1", 0, 0)
+	} else {
+		// terraform/modules/vpc creates one NAT gateway and Elastic IP per public subnet.
+		natGateways := len(config.PublicSubnets)
+		natMonthly := float64(natGateways)*prices.NatGatewayHourly*hours + natGB*prices.NatGatewayPerGB
+		add(costNetworking, "NAT gateways", fmt.Sprintf("%d", natGateways), natMonthly, natMonthly)
+
+		eipMonthly := float64(natGateways) * prices.PublicIPv4Hourly * hours
+		add(costNetworking, "Elastic IPs", fmt.Sprintf("%d", natGateways), eipMonthly, eipMonthly)
+	}
+
+	lbMonthly := prices.NetworkLoadBalancerHourly * hours
+	add(costLoadBalancer, "Kubernetes API load balancer", "1", lbMonthly, lbMonthly)
+
+	return estimate, nil
+}
+
+func sizeRange(min, max int) string {
+	if min == max {
+		return fmt.Sprintf("%d", min)
+	}
+	return fmt.Sprintf("%d-%d", min, max)
+}
+
+func formatCostRange(currency string, min, max float64) string {
+	if fmt.Sprintf("%.2f", min) == fmt.Sprintf("%.2f", max) {
+		return fmt.Sprintf("%.2f %s", min, currency)
+	}
+	return fmt.Sprintf("%.2f-%.2f %s", min, max, currency)
+}
+
+func printCostEstimate(out io.Writer, estimate CostEstimate) {
+	fmt.Fprintf(out, "\nCost Estimate: %s (%s)\n", estimate.Environment, estimate.Region)
+	fmt.Fprintln(out, strings.Repeat("=", 50))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CATEGORY\tRESOURCE\tQTY\tMONTHLY")
+	for _, item := range estimate.Items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.Category, item.Description, item.Quantity,
+			formatCostRange(estimate.Currency, item.MinMonthly, item.MaxMonthly))
+	}
+	min, max := estimate.Total("")
+	fmt.Fprintf(w, "\t\t\t\n")
+	fmt.Fprintf(w, "TOTAL\t\t\t%s\n", formatCostRange(estimate.Currency, min, max))
+	w.Flush()
+}
+
+func printCostComparison(out io.Writer, estimates []CostEstimate) {
+	fmt.Fprintf(out, "\nEnvironment Comparison (monthly)\n")
+	fmt.Fprintln(out, strings.Repeat("=", 50))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := []string{"CATEGORY"}
+	for _, estimate := range estimates {
+		header = append(header, strings.ToUpper(estimate.Environment))
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, category := range append(costCategories, "") {
+		row := []string{category}
+		if category == "" {
+			row[0] = "TOTAL"
+		}
+		for _, estimate := range estimates {
+			min, max := estimate.Total(category)
+			row = append(row, formatCostRange(estimate.Currency, min, max))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
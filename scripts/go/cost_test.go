@@ -0,0 +1,225 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestPricing(t *testing.T) PricingTable {
+	t.Helper()
+	pricing, err := loadPricing(filepath.Join("testdata", "pricing.yaml"))
+	if err != nil {
+		t.Fatalf("loading pricing fixture: %v", err)
+	}
+	return pricing
+}
+
+func TestLoadPricing(t *testing.T) {
+	bundled, err := loadPricing("")
+	if err != nil {
+		t.Fatalf("loading bundled pricing: %v", err)
+	}
+	for _, region := range []string{"us-east-1", "us-west-2", "eu-west-1"} {
+		if _, ok := bundled.Regions[region]; !ok {
+			t.Errorf("bundled pricing has no %s prices", region)
+		}
+	}
+
+	pricing := loadTestPricing(t)
+	if pricing.HoursPerMonth != 100 || pricing.Regions["us-east-1"].Instances["t3.large"] != 0.2 {
+		t.Errorf("unexpected fixture pricing: %+v", pricing)
+	}
+
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("currency: USD\nhoursPerMonth: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{invalid, filepath.Join(dir, "missing.yaml")} {
+		if _, err := loadPricing(path); err == nil {
+			t.Errorf("loadPricing(%s) succeeded, want an error", path)
+		}
+	}
+}
+
+func costTestConfig() Config {
+	return Config{
+		Environment:    "staging",
+		Region:         "us-east-1",
+		PublicSubnets:  []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"},
+		PrivateSubnets: []string{"10.0.10.0/24", "10.0.11.0/24", "10.0.12.0/24"},
+		InstanceGroups: []InstanceGroup{
+			{Name: "master-us-east-1a", Role: roleMaster, MachineType: "t3.medium", MinSize: 1, MaxSize: 1},
+			{Name: "nodes", Role: roleNode, MachineType: "t3.large", MinSize: 2, MaxSize: 4},
+		},
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	type totals map[string][2]float64
+
+	tests := []struct {
+		name   string
+		config func() Config
+		natGB  float64
+		want   totals
+		items  []string
+	}{
+		{
+			name:   "standard",
+			config: costTestConfig,
+			natGB:  100,
+			want: totals{
+				costCompute:      {50, 90},
+				costStorage:      {44, 69.6},
+				costNetworking:   {28, 28},
+				costLoadBalancer: {2, 2},
+				"":               {124, 189.6},
+			},
+			items: []string{"NAT gateways", "Elastic IPs"},
+		},
+		{
+			name: "spot instance group",
+			config: func() Config {
+				config := costTestConfig()
+				config.InstanceGroups = append(config.InstanceGroups, InstanceGroup{
+					Name: "spot", Role: roleNode, MachineType: "t3.large", MinSize: 0, MaxSize: 2, Spot: true, RootVolumeSize: 50,
+				})
+				return config
+			},
+			want: totals{
+				costCompute: {50, 110},
+				costStorage: {44, 79.6},
+			},
+			items: []string{"spot (t3.large spot)", "spot root volumes (50 GiB gp3)"},
+		},
+		{
+			name: "airgapped",
+			config: func() Config {
+				config := costTestConfig()
+				config.Airgapped = true
+				return config
+			},
+			natGB: 100,
+			want: totals{
+				// Seven interface endpoints in each of three private subnets
+				costNetworking: {21, 21},
+			},
+			items: []string{"Interface endpoints", "S3 gateway endpoint"},
+		},
+	}
+
+	pricing := loadTestPricing(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimate, err := estimateCost(tt.config(), pricing, tt.natGB)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for category, want := range tt.want {
+				min, max := estimate.Total(category)
+				if !costEqual(min, want[0]) || !costEqual(max, want[1]) {
+					t.Errorf("Total(%q) = %.2f-%.2f, want %.2f-%.2f", category, min, max, want[0], want[1])
+				}
+			}
+			for _, description := range tt.items {
+				if !hasCostItem(estimate, description) {
+					t.Errorf("estimate has no %q line item", description)
+				}
+			}
+		})
+	}
+}
+
+func TestEstimateCostErrors(t *testing.T) {
+	pricing := loadTestPricing(t)
+
+	config := costTestConfig()
+	config.Region = "ap-south-1"
+	if _, err := estimateCost(config, pricing, 0); err == nil || !strings.Contains(err.Error(), "ap-south-1") {
+		t.Errorf("unknown region: got error %v", err)
+	}
+
+	config = costTestConfig()
+	config.InstanceGroups[1].MachineType = "p4d.24xlarge"
+	if _, err := estimateCost(config, pricing, 0); err == nil || !strings.Contains(err.Error(), "p4d.24xlarge") {
+		t.Errorf("unknown instance type: got error %v", err)
+	}
+}
+
+func TestPrintCostComparison(t *testing.T) {
+	pricing := loadTestPricing(t)
+
+	staging, err := estimateCost(costTestConfig(), pricing, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := costTestConfig()
+	config.Environment = "production"
+	config.InstanceGroups[1].MinSize = 4
+	production, err := estimateCost(config, pricing, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	printCostComparison(&out, []CostEstimate{staging, production})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := [][]string{
+		{"CATEGORY", "STAGING", "PRODUCTION"},
+		{"Compute", "50.00-90.00 USD", "90.00 USD"},
+		{"Networking", "18.00 USD", "18.00 USD"},
+		{"Storage", "44.00-69.60 USD", "69.60 USD"},
+		{"Load", "balancing", "2.00 USD", "2.00 USD"},
+		{"TOTAL", "114.00-179.60 USD", "179.60 USD"},
+	}
+	rows := lines[len(lines)-len(want):]
+	for i, fields := range want {
+		if got := strings.Fields(rows[i]); strings.Join(got, " ") != strings.Join(fields, " ") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], strings.Join(fields, " "))
+		}
+	}
+}
+
+func TestCompareConfigsIgnoreEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aegis.production.yaml")
+	if err := os.WriteFile(path, []byte("environment: production\nregion: eu-west-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AEGIS_ENVIRONMENT", "staging")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	compared, err := loadConfigFrom(path, noEnvironment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compared.Environment != "production" || compared.Region != "eu-west-1" {
+		t.Errorf("compared config = %s in %s, want production in eu-west-1", compared.Environment, compared.Region)
+	}
+
+	primary, err := loadConfigFrom(path, os.Getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.Environment != "staging" || primary.Region != "us-east-1" {
+		t.Errorf("primary config = %s in %s, want the environment overrides", primary.Environment, primary.Region)
+	}
+}
+
+func costEqual(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+func hasCostItem(estimate CostEstimate, description string) bool {
+	for _, item := range estimate.Items {
+		if item.Description == description {
+			return true
+		}
+	}
+	return false
+}
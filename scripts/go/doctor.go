@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/spf13/cobra"
+
+	"aegis-k8s-framework/zones"
+)
+
+// makefilePath is the top-level Makefile that pins the required tool versions.
+const makefilePath = "../../Makefile"
+
+// Tool versions used when the Makefile cannot be read. Keep in sync with the
+// variables at the top of the Makefile.
+var defaultToolVersions = map[string]string{
+	"TERRAFORM_VERSION": "1.5.0",
+	"KUBECTL_VERSION":   "v1.28.0",
+	"KOPS_VERSION":      "v1.28.0",
+}
+
+const (
+	doctorOK   = "OK"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the local environment can provision clusters",
+	Long: `Check the config file, required tool versions against the Makefile, AWS
+credentials, write access to the working directories and the cluster template.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, configErr := loadConfigFrom(configPath, os.Getenv)
+		versions := requiredToolVersions(makefilePath)
+
+		checks := []doctorCheck{
+			checkConfigFile(configPath, configErr),
+			checkTerraformVersion(versions["TERRAFORM_VERSION"]),
+			checkKopsVersion(versions["KOPS_VERSION"]),
+			checkKubectlVersion(versions["KUBECTL_VERSION"]),
+			checkAWSCredentials(),
+			checkWritableDir("Config directory", filepath.Dir(configPath)),
+			checkWritableDir("kops directory", kopsDir),
+		}
+		// The remaining checks need a config; without one they are skipped
+		// rather than run against the defaults.
+		if configErr == nil {
+			checks = append(checks,
+				checkClusterTemplate(config),
+				checkPeeredNetworks(config),
+				checkAvailabilityZones(config))
+		} else {
+			for _, name := range []string{"Cluster template", "Peered networks", "Availability zones"} {
+				checks = append(checks, doctorCheck{Name: name, Status: doctorWarn, Message: "skipped, the config file is invalid"})
+			}
+		}
+
+		if printDoctorChecks(os.Stdout, checks) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+type doctorCheck struct {
+	Name    string
+	Status  string
+	Message string
+}
+
+// checkConfigFile reports the error of loading the config file at path. A
+// missing file is only a warning, as the built-in defaults apply.
+func checkConfigFile(path string, err error) doctorCheck {
+	check := doctorCheck{Name: "Config file"}
+
+	switch _, statErr := os.Stat(path); {
+	case err != nil:
+		check.Status, check.Message = doctorFail, err.Error()
+	case os.IsNotExist(statErr):
+		check.Status, check.Message = doctorWarn, fmt.Sprintf("%s not found, using the defaults", path)
+	default:
+		check.Status, check.Message = doctorOK, path
+	}
+	return check
+}
+
+// requiredToolVersions reads the *_VERSION variables from the Makefile,
+// falling back to defaultToolVersions for anything it cannot find.
+func requiredToolVersions(path string) map[string]string {
+	versions := make(map[string]string, len(defaultToolVersions))
+	for key, value := range defaultToolVersions {
+		versions[key] = value
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return versions
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":=")
+		key = strings.TrimSpace(key)
+		if _, known := versions[key]; found && known {
+			versions[key] = strings.TrimSpace(value)
+		}
+	}
+	return versions
+}
+
+var versionPattern = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)`)
+
+// parseVersion extracts the first major.minor.patch version found in s.
+func parseVersion(s string) ([3]int, bool) {
+	var version [3]int
+
+	match := versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return version, false
+	}
+	for i := range version {
+		version[i], _ = strconv.Atoi(match[i+1])
+	}
+	return version, true
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func toolOutput(name string, args ...string) (string, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return "", fmt.Errorf("%s not found in PATH", name)
+	}
+	output, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %v", name, strings.Join(args, " "), err)
+	}
+	return string(output), nil
+}
+
+func checkTerraformVersion(required string) doctorCheck {
+	check := doctorCheck{Name: "terraform"}
+
+	output, err := toolOutput("terraform", "version", "-json")
+	if err != nil {
+		check.Status, check.Message = doctorFail, err.Error()
+		return check
+	}
+	var parsed struct {
+		Version string `json:"terraform_version"`
+	}
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		check.Status, check.Message = doctorFail, fmt.Sprintf("cannot parse terraform version: %v", err)
+		return check
+	}
+
+	return versionCheck(check, parsed.Version, required, func(have, want [3]int) bool {
+		return have[0] == want[0] && compareVersions(have, want) >= 0
+	}, ">= "+required)
+}
+
+func checkKopsVersion(required string) doctorCheck {
+	check := doctorCheck{Name: "kops"}
+
+	output, err := toolOutput("kops", "version")
+	if err != nil {
+		check.Status, check.Message = doctorFail, err.Error()
+		return check
+	}
+
+	// kops only supports Kubernetes versions up to its own minor version.
+	return versionCheck(check, output, required, func(have, want [3]int) bool {
+		return have[0] == want[0] && have[1] == want[1] && have[2] >= want[2]
+	}, required+".x")
+}
+
+func checkKubectlVersion(required string) doctorCheck {
+	check := doctorCheck{Name: "kubectl"}
+
+	output, err := toolOutput("kubectl", "version", "--client", "-o", "json")
+	if err != nil {
+		check.Status, check.Message = doctorFail, err.Error()
+		return check
+	}
+	var parsed struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+	}
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		check.Status, check.Message = doctorFail, fmt.Sprintf("cannot parse kubectl version: %v", err)
+		return check
+	}
+
+	// kubectl is supported within one minor version of the API server.
+	return versionCheck(check, parsed.ClientVersion.GitVersion, required, func(have, want [3]int) bool {
+		skew := have[1] - want[1]
+		return have[0] == want[0] && skew >= -1 && skew <= 1
+	}, required+" ±1 minor")
+}
+
+func versionCheck(check doctorCheck, installed, required string, compatible func(have, want [3]int) bool, expectation string) doctorCheck {
+	have, ok := parseVersion(installed)
+	if !ok {
+		check.Status, check.Message = doctorFail, fmt.Sprintf("cannot determine version from %q", strings.TrimSpace(installed))
+		return check
+	}
+	want, ok := parseVersion(required)
+	if !ok {
+		check.Status, check.Message = doctorWarn, fmt.Sprintf("invalid required version %q", required)
+		return check
+	}
+
+	found := fmt.Sprintf("%d.%d.%d", have[0], have[1], have[2])
+	if !compatible(have, want) {
+		check.Status, check.Message = doctorFail, fmt.Sprintf("found %s, need %s", found, expectation)
+		return check
+	}
+	check.Status, check.Message = doctorOK, found
+	return check
+}
+
+// checkAWSCredentials only looks for locally configured credentials so that
+// it works offline; it does not call STS.
+func checkAWSCredentials() doctorCheck {
+	check := doctorCheck{Name: "AWS credentials"}
+
+	if os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" && os.Getenv("AWS_ROLE_ARN") != "" {
+		check.Status, check.Message = doctorOK, "web identity (AWS_ROLE_ARN)"
+		return check
+	}
+
+	chain := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvProvider{},
+		&credentials.SharedCredentialsProvider{Profile: os.Getenv("AWS_PROFILE")},
+	})
+	value, err := chain.Get()
+	if err != nil {
+		check.Status = doctorFail
+		check.Message = "no credentials in environment or shared credentials file (run aws configure)"
+		return check
+	}
+
+	check.Status, check.Message = doctorOK, value.ProviderName
+	return check
+}
+
+func checkWritableDir(name, dir string) doctorCheck {
+	check := doctorCheck{Name: name}
+
+	file, err := os.CreateTemp(dir, ".aegis-doctor-*")
+	if err != nil {
+		check.Status, check.Message = doctorFail, fmt.Sprintf("%s is not writable: %v", dir, err)
+		return check
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	check.Status, check.Message = doctorOK, dir
+	return check
+}
+
+func checkClusterTemplate(config Config) doctorCheck {
+	check := doctorCheck{Name: "Cluster template"}
+
+	network, err := clusterNetwork(config)
+	if err != nil {
+		// Airgapped clusters render once terraform has created the VPC
+		check.Status, check.Message = doctorWarn, err.Error()
+		return check
+	}
+	content, err := renderClusterConfig(config, network)
+	if err != nil {
+		check.Status, check.Message = doctorFail, err.Error()
+		return check
+	}
+	if placeholder := regexp.MustCompile(`{{[A-Z0-9_]+}}`).FindString(content); placeholder != "" {
+		check.Status, check.Message = doctorFail, fmt.Sprintf("unresolved placeholder %s", placeholder)
+		return check
+	}
+
+	check.Status = doctorOK
+	check.Message = filepath.Join(kopsDir, "templates", "cluster.yaml.template")
+	return check
+}
+
+func checkPeeredNetworks(config Config) doctorCheck {
+	check := doctorCheck{Name: "Peered networks"}
+
+	conflicts, err := networkConflicts(config)
+	switch {
+	case err != nil:
+		check.Status, check.Message = doctorFail, err.Error()
+	case len(conflicts) > 0:
+		check.Status, check.Message = doctorFail, conflicts[0].String()
+		if len(conflicts) > 1 {
+			check.Message += fmt.Sprintf(" (and %d more; see 'aegis network check')", len(conflicts)-1)
+		}
+	case len(config.PeeredNetworks) == 0:
+		check.Status, check.Message = doctorOK, "none configured"
+	default:
+		check.Status = doctorOK
+		check.Message = fmt.Sprintf("VPC %s overlaps none of %d networks", config.VpcCidr, len(config.PeeredNetworks))
+	}
+	return check
+}
+
+// checkAvailabilityZones uses the offline zone catalog, so it cannot see
+// zones that only exist in the calling account.
+func checkAvailabilityZones(config Config) doctorCheck {
+	check := doctorCheck{Name: "Availability zones"}
+
+	catalog, err := zones.LoadCatalog("", config.LocalZoneGroups)
+	if err != nil {
+		check.Status, check.Message = doctorFail, err.Error()
+		return check
+	}
+	err = checkTemplateZones(catalog, config.Region)
+	switch {
+	case errors.Is(err, zones.ErrUnknownRegion):
+		check.Status = doctorWarn
+		check.Message = fmt.Sprintf("%s is not in the zone catalog; run 'aegis zones --live'", config.Region)
+	case err != nil:
+		// The catalog is an example of a typical account; zone names and
+		// availability differ between accounts
+		check.Status = doctorWarn
+		check.Message = strings.ReplaceAll(err.Error(), "\n", "; ") + "; check with 'aegis zones --live'"
+	default:
+		check.Status, check.Message = doctorOK, strings.Join(templateZones(config.Region), ", ")
+	}
+	return check
+}
+
+// printDoctorChecks writes the check results and reports whether any failed.
+func printDoctorChecks(out io.Writer, checks []doctorCheck) bool {
+	failed := false
+	for _, check := range checks {
+		fmt.Fprintf(out, "[%-4s] %-18s %s\n", check.Status, check.Name, check.Message)
+		if check.Status == doctorFail {
+			failed = true
+		}
+	}
+
+	if failed {
+		fmt.Fprintln(out, "\nSome checks failed. Run 'make setup-dev' for installation instructions.")
+	} else {
+		fmt.Fprintln(out, "\nAll checks passed.")
+	}
+	return failed
+}
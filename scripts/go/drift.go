@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const manifestsDir = "../../manifests"
+
+// Exit codes follow terraform's -detailed-exitcode convention.
+const (
+	driftExitError = 1
+	driftExitFound = 2
+)
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Detect drift between the desired config and live infrastructure",
+	Long: `Compare the desired state against what is running:
+  - Terraform: refresh-only plan of the AWS infrastructure (security groups, NACLs, ...)
+  - kops: live cluster spec and instance groups against the rendered template
+  - Kubernetes: live objects against manifests/
+
+Exits 0 when nothing drifted, 2 when drift was found and 1 when a check failed to run.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+
+		checks := []driftCheck{
+			checkTerraformDrift(config),
+			checkKopsDrift(config),
+			checkKubernetesDrift(),
+		}
+		writeDriftReport(os.Stdout, config, checks)
+
+		os.Exit(driftExitCode(checks))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+}
+
+// driftCheck is the outcome of comparing one layer of the stack.
+type driftCheck struct {
+	Name    string
+	Drifted bool
+	Details string
+	// Failed lists the parts of the check that could not be compared, while
+	// the rest of the check still ran.
+	Failed []string
+	Err    error
+}
+
+func checkTerraformDrift(config Config) driftCheck {
+	check := driftCheck{Name: "Terraform infrastructure (refresh-only plan)"}
+
+	args := []string{"plan", "-refresh-only", "-detailed-exitcode", "-no-color", "-input=false"}
+	cmd := exec.Command("terraform", append(args, terraformVars(config)...)...)
+	cmd.Dir = terraformDir
+
+	output, code, err := captureCommand(cmd)
+	switch {
+	case err != nil:
+		check.Err = err
+	case code == 0:
+	case code == 2:
+		check.Drifted = true
+		check.Details = output
+	default:
+		check.Err = fmt.Errorf("terraform plan exited with code %d", code)
+		check.Details = output
+	}
+	return check
+}
+
+func checkKopsDrift(config Config) driftCheck {
+	check := driftCheck{Name: "kops cluster spec and instance groups"}
+
+	network, err := clusterNetwork(config)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	rendered, err := renderClusterConfig(config, network)
+	if err != nil {
+		check.Err = fmt.Errorf("rendering cluster template: %w", err)
+		return check
+	}
+	desired, err := decodeYAMLDocuments(rendered)
+	if err != nil {
+		check.Err = fmt.Errorf("parsing rendered template: %w", err)
+		return check
+	}
+
+	var live []map[string]interface{}
+	for _, resource := range []string{"cluster", "instancegroups"} {
+		cmd := exec.Command("kops", "get", resource, "--name", config.ClusterName, "-o", "yaml")
+		output, code, err := captureCommand(cmd)
+		if err != nil || code != 0 {
+			check.Err = fmt.Errorf("kops get %s failed (exit %d): %v", resource, code, err)
+			check.Details = output
+			return check
+		}
+		documents, err := decodeYAMLDocuments(output)
+		if err != nil {
+			check.Err = fmt.Errorf("parsing kops get %s output: %w", resource, err)
+			return check
+		}
+		live = append(live, documents...)
+	}
+
+	var lines []string
+	for _, want := range desired {
+		key := resourceKey(want)
+		have := findResource(live, key)
+		if have == nil {
+			lines = append(lines, fmt.Sprintf("- %s: missing from cluster", key))
+			continue
+		}
+		for _, diff := range diffYAMLSubset(want["spec"], have["spec"], "spec") {
+			lines = append(lines, key+" "+diff)
+		}
+	}
+	for _, have := range live {
+		key := resourceKey(have)
+		if findResource(desired, key) == nil {
+			lines = append(lines, fmt.Sprintf("+ %s: not declared in config", key))
+		}
+	}
+
+	if len(lines) > 0 {
+		check.Drifted = true
+		check.Details = strings.Join(lines, "\n")
+	}
+	return check
+}
+
+func checkKubernetesDrift() driftCheck {
+	check := driftCheck{Name: "Kubernetes objects (manifests/)"}
+
+	files, err := kubernetesManifests(manifestsDir)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	return diffManifests(check, files, func(file string) (string, int, error) {
+		return captureCommand(exec.Command("kubectl", "diff", "-f", file))
+	})
+}
+
+// diffManifests runs diff on each manifest file. kubectl diff exits 1 when
+// the file drifted and above 1 when it could not be diffed, for example
+// because a CRD is not installed; such files are reported without hiding
+// the drift found in the others.
+func diffManifests(check driftCheck, files []string, diff func(file string) (string, int, error)) driftCheck {
+	var details []string
+	for _, file := range files {
+		output, code, err := diff(file)
+		switch {
+		case err != nil:
+			// kubectl itself is unavailable, so no file can be diffed
+			check.Err = err
+			return check
+		case code == 0:
+		case code == 1:
+			check.Drifted = true
+			details = append(details, output)
+		default:
+			check.Failed = append(check.Failed, fmt.Sprintf("%s: kubectl diff exited with code %d: %s",
+				file, code, strings.TrimSpace(output)))
+		}
+	}
+	check.Details = strings.Join(details, "\n")
+	return check
+}
+
+// kubernetesManifests returns the YAML files under dir that hold Kubernetes
+// objects. Files with a document lacking apiVersion or kind, such as Helm
+// values, and files with config file formats that the API server reads
+// from disk, such as the kops EncryptionConfiguration, are skipped.
+func kubernetesManifests(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Templates with unrendered {{ }} placeholders do not parse; they
+		// are rendered before they are applied, so there is nothing to diff
+		documents, err := decodeYAMLDocuments(string(data))
+		if err == nil && len(documents) > 0 && allKubernetesObjects(documents) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func allKubernetesObjects(documents []map[string]interface{}) bool {
+	for _, document := range documents {
+		apiVersion, _ := document["apiVersion"].(string)
+		kind, _ := document["kind"].(string)
+		if apiVersion == "" || kind == "" {
+			return false
+		}
+		group, _, _ := strings.Cut(apiVersion, "/")
+		if strings.HasSuffix(group, ".config.k8s.io") {
+			return false
+		}
+	}
+	return true
+}
+
+// captureCommand runs cmd and returns its combined output and exit code. The
+// error is only set when the command could not be started.
+func captureCommand(cmd *exec.Cmd) (string, int, error) {
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return output.String(), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return output.String(), -1, err
+	}
+	return output.String(), 0, nil
+}
+
+func decodeYAMLDocuments(content string) ([]map[string]interface{}, error) {
+	var documents []map[string]interface{}
+
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var document map[string]interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if document != nil {
+			documents = append(documents, document)
+		}
+	}
+	return documents, nil
+}
+
+func resourceKey(document map[string]interface{}) string {
+	name := ""
+	if metadata, ok := document["metadata"].(map[string]interface{}); ok {
+		name, _ = metadata["name"].(string)
+	}
+	return fmt.Sprintf("%v/%s", document["kind"], name)
+}
+
+func findResource(documents []map[string]interface{}, key string) map[string]interface{} {
+	for _, document := range documents {
+		if resourceKey(document) == key {
+			return document
+		}
+	}
+	return nil
+}
+
+// diffYAMLSubset reports every value in desired that is absent from or
+// different in live. Fields that only exist in live are ignored, since kops
+// fills in defaults the template never sets.
+func diffYAMLSubset(desired, live interface{}, path string) []string {
+	switch want := desired.(type) {
+	case map[string]interface{}:
+		have, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("~ %s: expected a mapping, found %v", path, live)}
+		}
+		keys := make([]string, 0, len(want))
+		for key := range want {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, key := range keys {
+			value, exists := have[key]
+			if !exists {
+				diffs = append(diffs, fmt.Sprintf("- %s.%s: %v", path, key, want[key]))
+				continue
+			}
+			diffs = append(diffs, diffYAMLSubset(want[key], value, path+"."+key)...)
+		}
+		return diffs
+
+	case []interface{}:
+		have, ok := live.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("~ %s: expected a list, found %v", path, live)}
+		}
+
+		var diffs []string
+		for i, item := range want {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(have) {
+				diffs = append(diffs, fmt.Sprintf("- %s: %v", itemPath, item))
+				continue
+			}
+			diffs = append(diffs, diffYAMLSubset(item, have[i], itemPath)...)
+		}
+		for i := len(want); i < len(have); i++ {
+			diffs = append(diffs, fmt.Sprintf("+ %s[%d]: %v", path, i, have[i]))
+		}
+		return diffs
+
+	default:
+		if fmt.Sprint(desired) != fmt.Sprint(live) {
+			return []string{fmt.Sprintf("~ %s: %v -> %v", path, desired, live)}
+		}
+		return nil
+	}
+}
+
+func writeDriftReport(out io.Writer, config Config, checks []driftCheck) {
+	fmt.Fprintf(out, "Aegis Drift Report\n")
+	fmt.Fprintf(out, "Environment: %s\n", config.Environment)
+	fmt.Fprintf(out, "Cluster: %s\n", config.ClusterName)
+	fmt.Fprintln(out, strings.Repeat("=", 50))
+
+	drifted := 0
+	for _, check := range checks {
+		status := "OK"
+		switch {
+		case check.Err != nil:
+			status = "ERROR"
+		case check.Drifted:
+			status = "DRIFT"
+			drifted++
+		case len(check.Failed) > 0:
+			status = "INCOMPLETE"
+		}
+
+		fmt.Fprintf(out, "\n[%s] %s\n", status, check.Name)
+		if check.Err != nil {
+			fmt.Fprintf(out, "  Error: %v\n", check.Err)
+		}
+		for _, failure := range check.Failed {
+			fmt.Fprintf(out, "  Error: %s\n", failure)
+		}
+		if check.Details != "" {
+			for _, line := range strings.Split(strings.TrimRight(check.Details, "\n"), "\n") {
+				fmt.Fprintf(out, "  %s\n", line)
+			}
+		}
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, strings.Repeat("=", 50))
+	fmt.Fprintf(out, "Summary: %d of %d checks detected drift\n", drifted, len(checks))
+}
+
+// driftExitCode returns driftExitError when a check could not run at all.
+// Drift takes precedence over checks that only partly failed.
+func driftExitCode(checks []driftCheck) int {
+	code := 0
+	for _, check := range checks {
+		if check.Err != nil {
+			return driftExitError
+		}
+		if check.Drifted {
+			code = driftExitFound
+		}
+	}
+	if code == 0 {
+		for _, check := range checks {
+			if len(check.Failed) > 0 {
+				return driftExitError
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKubernetesManifests(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"objects.yaml":      "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n",
+		"helm-values.yaml":  "global:\n  image:\n    tag: v2\n",
+		"mixed.yaml":        "apiVersion: v1\nkind: Namespace\n---\nreplicas: 2\n",
+		"encryption.yaml":   "# comment\n---\napiVersion: apiserver.config.k8s.io/v1\nkind: EncryptionConfiguration\n",
+		"nested/policy.yml": "apiVersion: kyverno.io/v1\nkind: ClusterPolicy\n",
+		"README.md":         "apiVersion: v1\nkind: Namespace\n",
+		"empty.yaml":        "# nothing here\n",
+		"template.yaml":     "apiVersion: v1\nkind: Secret\ndata:\n  key: {{ KEY }}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := kubernetesManifests(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "nested", "policy.yml"), filepath.Join(dir, "objects.yaml")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kubernetesManifests() = %v, want %v", got, want)
+	}
+}
+
+func TestKubernetesManifestsSkipsNonObjects(t *testing.T) {
+	got, err := kubernetesManifests(manifestsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 {
+		t.Fatalf("no manifests found in %s", manifestsDir)
+	}
+	for _, file := range got {
+		for _, skipped := range []string{"helm-values.yaml", "encryption-config.yaml"} {
+			if filepath.Base(file) == skipped {
+				t.Errorf("%s is not a Kubernetes object manifest", file)
+			}
+		}
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	type result struct {
+		output string
+		code   int
+	}
+	tests := []struct {
+		name        string
+		results     map[string]result
+		wantDrifted bool
+		wantDetails string
+		wantFailed  []string
+	}{
+		{
+			name:    "no drift",
+			results: map[string]result{"a.yaml": {"", 0}, "b.yaml": {"", 0}},
+		},
+		{
+			name:        "drift in one file",
+			results:     map[string]result{"a.yaml": {"", 0}, "b.yaml": {"+ replicas: 3", 1}},
+			wantDrifted: true,
+			wantDetails: "+ replicas: 3",
+		},
+		{
+			name:        "failed file does not hide drift",
+			results:     map[string]result{"a.yaml": {"no matches for kind \"ClusterPolicy\"\n", 2}, "b.yaml": {"+ replicas: 3", 1}},
+			wantDrifted: true,
+			wantDetails: "+ replicas: 3",
+			wantFailed:  []string{`a.yaml: kubectl diff exited with code 2: no matches for kind "ClusterPolicy"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []string{"a.yaml", "b.yaml"}
+			check := diffManifests(driftCheck{}, files, func(file string) (string, int, error) {
+				return tt.results[file].output, tt.results[file].code, nil
+			})
+
+			if check.Err != nil {
+				t.Fatalf("unexpected error: %v", check.Err)
+			}
+			if check.Drifted != tt.wantDrifted {
+				t.Errorf("Drifted = %v, want %v", check.Drifted, tt.wantDrifted)
+			}
+			if check.Details != tt.wantDetails {
+				t.Errorf("Details = %q, want %q", check.Details, tt.wantDetails)
+			}
+			if !reflect.DeepEqual(check.Failed, tt.wantFailed) {
+				t.Errorf("Failed = %q, want %q", check.Failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestDiffManifestsWithoutKubectl(t *testing.T) {
+	calls := 0
+	check := diffManifests(driftCheck{}, []string{"a.yaml", "b.yaml"}, func(file string) (string, int, error) {
+		calls++
+		return "", -1, errors.New(`exec: "kubectl": executable file not found in $PATH`)
+	})
+	if check.Err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls != 1 {
+		t.Errorf("diff was called %d times, want 1", calls)
+	}
+}
+
+func TestDiffYAMLSubset(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired string
+		live    string
+		want    []string
+	}{
+		{
+			name:    "live defaults are ignored",
+			desired: "machineType: t3.large\n",
+			live:    "machineType: t3.large\nrootVolumeSize: 64\n",
+		},
+		{
+			name:    "changed value",
+			desired: "maxSize: 10\n",
+			live:    "maxSize: 12\n",
+			want:    []string{"~ spec.maxSize: 10 -> 12"},
+		},
+		{
+			name:    "missing key",
+			desired: "nodeLabels:\n  team: data\n",
+			live:    "nodeLabels: {}\n",
+			want:    []string{"- spec.nodeLabels.team: data"},
+		},
+		{
+			name:    "missing list item",
+			desired: "subnets: [a, b]\n",
+			live:    "subnets: [a]\n",
+			want:    []string{"- spec.subnets[1]: b"},
+		},
+		{
+			name:    "extra list items",
+			desired: "subnets: [a]\n",
+			live:    "subnets: [a, c]\n",
+			want:    []string{"+ spec.subnets[1]: c"},
+		},
+		{
+			name:    "type mismatch",
+			desired: "taints:\n  dedicated: batch\n",
+			live:    "taints: [dedicated=batch]\n",
+			want:    []string{"~ spec.taints: expected a mapping, found [dedicated=batch]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := decodeSpec(t, tt.desired)
+			live := decodeSpec(t, tt.live)
+
+			got := diffYAMLSubset(desired, live, "spec")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffYAMLSubset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func decodeSpec(t *testing.T, content string) map[string]interface{} {
+	t.Helper()
+	documents, err := decodeYAMLDocuments(content)
+	if err != nil || len(documents) != 1 {
+		t.Fatalf("decoding %q: %v", content, err)
+	}
+	return documents[0]
+}
+
+func TestDriftExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []driftCheck
+		want   int
+	}{
+		{"clean", []driftCheck{{}, {}}, 0},
+		{"drift", []driftCheck{{}, {Drifted: true}}, driftExitFound},
+		{"error", []driftCheck{{Drifted: true}, {Err: errors.New("boom")}}, driftExitError},
+		{"partial failure", []driftCheck{{}, {Failed: []string{"a.yaml"}}}, driftExitError},
+		{"drift with partial failure", []driftCheck{{Drifted: true, Failed: []string{"a.yaml"}}}, driftExitFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := driftExitCode(tt.checks); got != tt.want {
+				t.Errorf("driftExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteDriftReportIncomplete(t *testing.T) {
+	var out strings.Builder
+	writeDriftReport(&out, Config{Environment: "staging"}, []driftCheck{
+		{Name: "Kubernetes objects (manifests/)", Failed: []string{"a.yaml: kubectl diff exited with code 2"}},
+	})
+
+	for _, want := range []string{"[INCOMPLETE] Kubernetes objects", "  Error: a.yaml: kubectl diff exited with code 2"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report is missing %q:\n%s", want, out.String())
+		}
+	}
+}
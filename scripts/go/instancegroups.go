@@ -0,0 +1,598 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"aegis-k8s-framework/zones"
+)
+
+const (
+	defaultNodeImage = "099720109477/ubuntu/images/hvm-ssd/ubuntu-focal-20.04-amd64-server-20230517"
+
+	roleMaster = "Master"
+	roleNode   = "Node"
+)
+
+// InstanceGroup describes a kops instance group as declared in the config file.
+type InstanceGroup struct {
+	Name        string `yaml:"name"`
+	Role        string `yaml:"role"`
+	MachineType string `yaml:"machineType"`
+	Image       string `yaml:"image,omitempty"`
+	MinSize     int    `yaml:"minSize"`
+	MaxSize     int    `yaml:"maxSize"`
+	// RootVolumeSize is the root EBS volume size in GiB; kops picks a
+	// role-specific default when it is zero.
+	RootVolumeSize int               `yaml:"rootVolumeSize,omitempty"`
+	Spot           bool              `yaml:"spot,omitempty"`
+	MaxPrice       string            `yaml:"maxPrice,omitempty"`
+	Taints         []string          `yaml:"taints,omitempty"`
+	Labels         map[string]string `yaml:"labels,omitempty"`
+	Subnets        []string          `yaml:"subnets"`
+}
+
+var igCmd = &cobra.Command{
+	Use:   "ig",
+	Short: "Manage cluster instance groups",
+	Long: `Manage kops instance groups declaratively through the config file.
+Changes are written to the config file and only applied to the cluster when --yes is given.`,
+}
+
+var igListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured instance groups",
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+		printInstanceGroups(os.Stdout, config.InstanceGroups)
+	},
+}
+
+var igScaleCmd = &cobra.Command{
+	Use:   "scale NAME",
+	Short: "Change the size of an instance group",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("min") && !cmd.Flags().Changed("max") {
+			log.Fatal("Nothing to scale: set --min, --max or both")
+		}
+
+		config := loadConfig()
+
+		ig := findInstanceGroup(config.InstanceGroups, args[0])
+		if ig == nil {
+			log.Fatalf("Instance group %s not found", args[0])
+		}
+		if cmd.Flags().Changed("min") {
+			ig.MinSize = igScaleMin
+		}
+		if cmd.Flags().Changed("max") {
+			ig.MaxSize = igScaleMax
+		}
+
+		updateInstanceGroups(config)
+	},
+}
+
+var igAddCmd = &cobra.Command{
+	Use:   "add NAME",
+	Short: "Add an instance group",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+
+		if findInstanceGroup(config.InstanceGroups, args[0]) != nil {
+			log.Fatalf("Instance group %s already exists", args[0])
+		}
+
+		labels, err := parseLabels(igLabels)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		subnets := igSubnets
+		if len(subnets) == 0 {
+			strategy, err := zones.ParseStrategy(igPlacement)
+			if err != nil {
+				log.Fatal(err)
+			}
+			provider, err := zoneProvider(config, false)
+			if err != nil {
+				log.Fatalf("Failed to load zones: %v", err)
+			}
+			subnets, err = nodeGroupSubnets(provider, config.Region, strategy)
+			if err != nil {
+				log.Fatalf("Failed to place instance group %s: %v", args[0], err)
+			}
+		}
+
+		config.InstanceGroups = append(config.InstanceGroups, InstanceGroup{
+			Name:           args[0],
+			Role:           igRole,
+			MachineType:    igMachineType,
+			MinSize:        igMinSize,
+			MaxSize:        igMaxSize,
+			RootVolumeSize: igVolumeSize,
+			Spot:           igSpot,
+			MaxPrice:       igMaxPrice,
+			Taints:         igTaints,
+			Labels:         labels,
+			Subnets:        subnets,
+		})
+
+		updateInstanceGroups(config)
+	},
+}
+
+var igRemoveCmd = &cobra.Command{
+	Use:   "remove NAME",
+	Short: "Remove an instance group",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+
+		ig := findInstanceGroup(config.InstanceGroups, args[0])
+		if ig == nil {
+			log.Fatalf("Instance group %s not found", args[0])
+		}
+		if ig.Role == roleMaster {
+			log.Fatalf("Instance group %s hosts etcd members and cannot be removed", args[0])
+		}
+
+		remaining := make([]InstanceGroup, 0, len(config.InstanceGroups)-1)
+		for _, existing := range config.InstanceGroups {
+			if existing.Name != args[0] {
+				remaining = append(remaining, existing)
+			}
+		}
+		config.InstanceGroups = remaining
+
+		updateInstanceGroups(config)
+
+		// kops replace never deletes instance groups, so remove it explicitly,
+		// last, so that the group is only gone once the config no longer
+		// declares it.
+		if igApply {
+			cmd := exec.Command("kops", "delete", "instancegroup", args[0], "--name", config.ClusterName, "--yes")
+			runCommand(cmd)
+		}
+	},
+}
+
+var (
+	igApply       bool
+	igScaleMin    int
+	igScaleMax    int
+	igRole        string
+	igMachineType string
+	igMinSize     int
+	igMaxSize     int
+	igVolumeSize  int
+	igSpot        bool
+	igMaxPrice    string
+	igTaints      []string
+	igLabels      []string
+	igSubnets     []string
+	igPlacement   string
+)
+
+func init() {
+	igCmd.PersistentFlags().BoolVar(&igApply, "yes", false, "Apply the change to the cluster with kops")
+
+	igScaleCmd.Flags().IntVar(&igScaleMin, "min", 0, "Minimum number of instances")
+	igScaleCmd.Flags().IntVar(&igScaleMax, "max", 0, "Maximum number of instances")
+
+	igAddCmd.Flags().StringVar(&igRole, "role", roleNode, "Instance group role (Node or Master)")
+	igAddCmd.Flags().StringVar(&igMachineType, "machine-type", "t3.large", "EC2 instance type")
+	igAddCmd.Flags().IntVar(&igMinSize, "min", 1, "Minimum number of instances")
+	igAddCmd.Flags().IntVar(&igMaxSize, "max", 1, "Maximum number of instances")
+	igAddCmd.Flags().IntVar(&igVolumeSize, "root-volume-size", 0, "Root volume size in GiB (defaults to the kops default)")
+	igAddCmd.Flags().BoolVar(&igSpot, "spot", false, "Use spot instances instead of on-demand")
+	igAddCmd.Flags().StringVar(&igMaxPrice, "max-price", "", "Maximum hourly spot price (defaults to the on-demand price)")
+	igAddCmd.Flags().StringArrayVar(&igTaints, "taint", nil, "Node taint in key=value:Effect form (repeatable)")
+	igAddCmd.Flags().StringArrayVar(&igLabels, "label", nil, "Node label in key=value form (repeatable)")
+	igAddCmd.Flags().StringArrayVar(&igSubnets, "subnet", nil, "kops subnet name (repeatable, defaults to the private subnets chosen by --placement)")
+	igAddCmd.Flags().StringVar(&igPlacement, "placement", string(zones.Spread), "Zone placement without --subnet: spread (every zone) or pack (first zone only)")
+
+	igCmd.AddCommand(igListCmd)
+	igCmd.AddCommand(igScaleCmd)
+	igCmd.AddCommand(igAddCmd)
+	igCmd.AddCommand(igRemoveCmd)
+	rootCmd.AddCommand(igCmd)
+}
+
+// templateZoneSuffixes are the zones the cluster template places subnets and
+// etcd members in, as {{REGION}}a, {{REGION}}b and {{REGION}}c.
+var templateZoneSuffixes = []string{"a", "b", "c"}
+
+// templateZones returns the names of the zones used by the cluster template.
+func templateZones(region string) []string {
+	names := make([]string, 0, len(templateZoneSuffixes))
+	for _, suffix := range templateZoneSuffixes {
+		names = append(names, region+suffix)
+	}
+	return names
+}
+
+// defaultInstanceGroups returns the instance groups the cluster template
+// historically shipped with: one master per AZ and a private node pool.
+// Airgapped clusters have their masters in the private subnets too.
+func defaultInstanceGroups(provider zones.Provider, region string, airgapped bool) ([]InstanceGroup, error) {
+	regionZones, err := placementZones(provider, region)
+	if err != nil {
+		return nil, err
+	}
+	masters, err := zones.PlaceMasters(regionZones, len(templateZoneSuffixes))
+	if err != nil {
+		return nil, err
+	}
+	nodeSubnets, err := nodeGroupSubnets(provider, region, zones.Spread)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]InstanceGroup, 0, len(masters)+1)
+	for _, zone := range masters {
+		subnet := zone.Name
+		if airgapped {
+			subnet += "-private"
+		}
+		groups = append(groups, InstanceGroup{
+			Name:        "master-" + zone.Name,
+			Role:        roleMaster,
+			MachineType: "t3.medium",
+			MinSize:     1,
+			MaxSize:     1,
+			Subnets:     []string{subnet},
+		})
+	}
+	groups = append(groups, InstanceGroup{
+		Name:        "nodes",
+		Role:        roleNode,
+		MachineType: "t3.large",
+		MinSize:     3,
+		MaxSize:     10,
+		Subnets:     nodeSubnets,
+	})
+	return groups, nil
+}
+
+// clusterSubnetNames returns the kops subnet names defined by the cluster template.
+func clusterSubnetNames(region string) []string {
+	return append(templateZones(region), privateSubnetNames(region)...)
+}
+
+func privateSubnetNames(region string) []string {
+	var names []string
+	for _, zone := range templateZones(region) {
+		names = append(names, zone+"-private")
+	}
+	return names
+}
+
+// nodeGroupSubnets returns the private subnets a node group is placed in,
+// one per zone that strategy places its members in.
+func nodeGroupSubnets(provider zones.Provider, region string, strategy zones.Strategy) ([]string, error) {
+	regionZones, err := placementZones(provider, region)
+	if err != nil {
+		return nil, err
+	}
+	placement, err := zones.Place(regionZones, len(regionZones), strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets []string
+	for _, zone := range placement {
+		if subnet := zone.Name + "-private"; !slices.Contains(subnets, subnet) {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets, nil
+}
+
+// templateProvider is a zones.Provider that assumes every region has the
+// template zones. Loading the config places the default instance groups
+// with it, so that commands which only read the config never depend on the
+// zone catalog; the commands that place groups check the catalog.
+type templateProvider struct{}
+
+// Zones implements zones.Provider.
+func (templateProvider) Zones(region string) ([]zones.Zone, error) {
+	names := templateZones(region)
+	regionZones := make([]zones.Zone, 0, len(names))
+	for _, name := range names {
+		regionZones = append(regionZones, zones.Zone{
+			Name:        name,
+			Region:      region,
+			Type:        zones.TypeAvailabilityZone,
+			Group:       region,
+			OptInStatus: zones.OptInNotRequired,
+		})
+	}
+	return regionZones, nil
+}
+
+// placementZones returns the template zones of region, the only zones the
+// cluster template has subnets in. Regions the provider does not know are
+// assumed to have them; 'aegis doctor' warns about such regions.
+func placementZones(provider zones.Provider, region string) ([]zones.Zone, error) {
+	names := templateZones(region)
+	regionZones, err := provider.Zones(region)
+	if errors.Is(err, zones.ErrUnknownRegion) {
+		return templateProvider{}.Zones(region)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := zones.Require(provider, region, names); err != nil {
+		return nil, err
+	}
+
+	var result []zones.Zone
+	for _, zone := range regionZones {
+		if slices.Contains(names, zone.Name) {
+			result = append(result, zone)
+		}
+	}
+	return result, nil
+}
+
+func findInstanceGroup(groups []InstanceGroup, name string) *InstanceGroup {
+	for i := range groups {
+		if groups[i].Name == name {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+func parseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// validateInstanceGroups checks the instance groups in config for consistency
+// with the cluster template before they are rendered.
+func validateInstanceGroups(config Config) error {
+	validSubnets := make(map[string]bool)
+	for _, name := range clusterSubnetNames(config.Region) {
+		validSubnets[name] = true
+	}
+	// Airgapped clusters have no public subnets
+	publicSubnets := make(map[string]bool)
+	if config.Airgapped {
+		for _, name := range templateZones(config.Region) {
+			publicSubnets[name] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, ig := range config.InstanceGroups {
+		if ig.Name == "" {
+			return fmt.Errorf("instance group name cannot be empty")
+		}
+		if seen[ig.Name] {
+			return fmt.Errorf("duplicate instance group %s", ig.Name)
+		}
+		seen[ig.Name] = true
+
+		if ig.Role != roleMaster && ig.Role != roleNode {
+			return fmt.Errorf("instance group %s: invalid role %q", ig.Name, ig.Role)
+		}
+		if ig.MachineType == "" {
+			return fmt.Errorf("instance group %s: machine type is required", ig.Name)
+		}
+		if ig.MinSize < 0 || ig.MaxSize < ig.MinSize {
+			return fmt.Errorf("instance group %s: invalid size range %d-%d", ig.Name, ig.MinSize, ig.MaxSize)
+		}
+		// A master group scaled to zero takes its etcd member down with it
+		if ig.Role == roleMaster && ig.MinSize < 1 {
+			return fmt.Errorf("instance group %s: master groups need a minimum size of at least 1", ig.Name)
+		}
+		if ig.MaxPrice != "" && !ig.Spot {
+			return fmt.Errorf("instance group %s: max price requires spot", ig.Name)
+		}
+		if len(ig.Subnets) == 0 {
+			return fmt.Errorf("instance group %s: at least one subnet is required", ig.Name)
+		}
+		for _, subnet := range ig.Subnets {
+			if !validSubnets[subnet] {
+				return fmt.Errorf("instance group %s: unknown subnet %s", ig.Name, subnet)
+			}
+			if publicSubnets[subnet] {
+				return fmt.Errorf("instance group %s: airgapped clusters have no public subnet %s; use %s-private", ig.Name, subnet, subnet)
+			}
+		}
+		for _, taint := range ig.Taints {
+			if !strings.Contains(taint, ":") {
+				return fmt.Errorf("instance group %s: invalid taint %q, expected key=value:Effect", ig.Name, taint)
+			}
+		}
+	}
+
+	// The etcd members in the template are pinned to one master per AZ.
+	for _, zone := range templateZoneSuffixes {
+		name := "master-" + config.Region + zone
+		if ig := findInstanceGroup(config.InstanceGroups, name); ig == nil || ig.Role != roleMaster {
+			return fmt.Errorf("master instance group %s is required by the etcd cluster", name)
+		}
+	}
+
+	return nil
+}
+
+// kopsInstanceGroup mirrors the subset of the kops InstanceGroup resource
+// rendered by the CLI.
+type kopsInstanceGroup struct {
+	APIVersion string                `yaml:"apiVersion"`
+	Kind       string                `yaml:"kind"`
+	Metadata   kopsMetadata          `yaml:"metadata"`
+	Spec       kopsInstanceGroupSpec `yaml:"spec"`
+}
+
+type kopsMetadata struct {
+	Labels map[string]string `yaml:"labels"`
+	Name   string            `yaml:"name"`
+}
+
+type kopsInstanceGroupSpec struct {
+	Image                string                    `yaml:"image"`
+	MachineType          string                    `yaml:"machineType"`
+	MaxPrice             string                    `yaml:"maxPrice,omitempty"`
+	MaxSize              int                       `yaml:"maxSize"`
+	MinSize              int                       `yaml:"minSize"`
+	MixedInstancesPolicy *kopsMixedInstancesPolicy `yaml:"mixedInstancesPolicy,omitempty"`
+	NodeLabels           map[string]string         `yaml:"nodeLabels"`
+	Role                 string                    `yaml:"role"`
+	RootVolumeSize       int                       `yaml:"rootVolumeSize,omitempty"`
+	Subnets              []string                  `yaml:"subnets"`
+	Taints               []string                  `yaml:"taints,omitempty"`
+}
+
+type kopsMixedInstancesPolicy struct {
+	Instances              []string `yaml:"instances"`
+	OnDemandAboveBase      int      `yaml:"onDemandAboveBase"`
+	OnDemandBase           int      `yaml:"onDemandBase"`
+	SpotAllocationStrategy string   `yaml:"spotAllocationStrategy"`
+}
+
+// renderInstanceGroups renders the configured instance groups as kops
+// InstanceGroup YAML documents.
+func renderInstanceGroups(config Config) (string, error) {
+	if err := validateInstanceGroups(config); err != nil {
+		return "", err
+	}
+
+	documents := make([]string, 0, len(config.InstanceGroups))
+	for _, ig := range config.InstanceGroups {
+		nodeLabels := map[string]string{"kops.k8s.io/instancegroup": ig.Name}
+		for key, value := range ig.Labels {
+			nodeLabels[key] = value
+		}
+
+		image := ig.Image
+		if image == "" {
+			image = defaultNodeImage
+		}
+
+		resource := kopsInstanceGroup{
+			APIVersion: "kops.k8s.io/v1alpha2",
+			Kind:       "InstanceGroup",
+			Metadata: kopsMetadata{
+				Labels: map[string]string{"kops.k8s.io/cluster": config.ClusterName},
+				Name:   ig.Name,
+			},
+			Spec: kopsInstanceGroupSpec{
+				Image:          image,
+				MachineType:    ig.MachineType,
+				MaxSize:        ig.MaxSize,
+				MinSize:        ig.MinSize,
+				NodeLabels:     nodeLabels,
+				Role:           ig.Role,
+				RootVolumeSize: ig.RootVolumeSize,
+				Subnets:        ig.Subnets,
+				Taints:         ig.Taints,
+			},
+		}
+		if ig.Spot {
+			resource.Spec.MaxPrice = ig.MaxPrice
+			resource.Spec.MixedInstancesPolicy = &kopsMixedInstancesPolicy{
+				Instances:              []string{ig.MachineType},
+				SpotAllocationStrategy: "capacity-optimized",
+			}
+		}
+
+		data, err := marshalYAML(resource)
+		if err != nil {
+			return "", err
+		}
+		documents = append(documents, strings.TrimSuffix(string(data), "\n"))
+	}
+
+	return strings.Join(documents, "\n\n---\n"), nil
+}
+
+// updateInstanceGroups validates and persists config, renders the cluster
+// spec, and applies it when --yes was given.
+func updateInstanceGroups(config Config) {
+	if err := validateInstanceGroups(config); err != nil {
+		log.Fatal(err)
+	}
+	if err := saveInstanceGroups(configPath, config.InstanceGroups); err != nil {
+		log.Fatalf("Failed to write config %s: %v", configPath, err)
+	}
+	fmt.Printf("Updated instance groups in %s\n", configPath)
+
+	generateClusterConfig(config)
+	fmt.Printf("Rendered %s\n", filepath.Join(kopsDir, "cluster.yaml"))
+
+	if igApply {
+		applyClusterConfig(config)
+	} else {
+		fmt.Println("Run again with --yes to apply the change with kops")
+	}
+}
+
+// applyClusterConfig replaces the cluster spec in the kops state store with
+// the rendered cluster.yaml and updates the cloud resources.
+func applyClusterConfig(config Config) {
+	fmt.Println("Applying instance groups with kops...")
+
+	cmd := exec.Command("kops", "replace", "-f", "cluster.yaml", "--force")
+	cmd.Dir = kopsDir
+	runCommand(cmd)
+
+	cmd = exec.Command("kops", "update", "cluster", "--name", config.ClusterName, "--yes")
+	runCommand(cmd)
+
+	fmt.Println("Machine type or image changes require: kops rolling-update cluster --name " + config.ClusterName + " --yes")
+}
+
+func printInstanceGroups(out io.Writer, groups []InstanceGroup) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROLE\tMACHINE TYPE\tMIN\tMAX\tLIFECYCLE\tSUBNETS")
+	for _, ig := range groups {
+		lifecycle := "on-demand"
+		if ig.Spot {
+			lifecycle = "spot"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			ig.Name, ig.Role, ig.MachineType, ig.MinSize, ig.MaxSize, lifecycle, strings.Join(ig.Subnets, ","))
+	}
+	w.Flush()
+
+	for _, ig := range groups {
+		if len(ig.Taints) == 0 && len(ig.Labels) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(ig.Labels))
+		for key := range ig.Labels {
+			keys = append(keys, key+"="+ig.Labels[key])
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(out, "\n%s:\n  labels: %s\n  taints: %s\n", ig.Name, strings.Join(keys, ", "), strings.Join(ig.Taints, ", "))
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"aegis-k8s-framework/zones"
+)
+
+func testZoneProvider() *zones.Fake {
+	notOptedIn := zones.FakeRegion("test-2", "a", "b", "c")
+	notOptedIn[0].OptInStatus = zones.NotOptedIn
+	return &zones.Fake{Regions: map[string][]zones.Zone{
+		"test-1": zones.FakeRegion("test-1", "a", "b", "c", "d"),
+		"test-2": notOptedIn,
+		"test-3": zones.FakeRegion("test-3", "b", "c", "d"),
+	}}
+}
+
+func TestNodeGroupSubnets(t *testing.T) {
+	tests := []struct {
+		region   string
+		strategy zones.Strategy
+		want     []string
+		wantErr  bool
+	}{
+		{"test-1", zones.Spread, []string{"test-1a-private", "test-1b-private", "test-1c-private"}, false},
+		{"test-1", zones.Pack, []string{"test-1a-private"}, false},
+		// Regions the provider does not know are assumed to have the template zones
+		{"test-9", zones.Pack, []string{"test-9a-private"}, false},
+		{"test-2", zones.Pack, nil, true},
+		{"test-3", zones.Spread, nil, true},
+	}
+
+	provider := testZoneProvider()
+	for _, tt := range tests {
+		got, err := nodeGroupSubnets(provider, tt.region, tt.strategy)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("nodeGroupSubnets(%s, %s) error = %v, wantErr %v", tt.region, tt.strategy, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("nodeGroupSubnets(%s, %s) = %v, want %v", tt.region, tt.strategy, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultInstanceGroups(t *testing.T) {
+	provider := testZoneProvider()
+
+	groups, err := defaultInstanceGroups(provider, "test-1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	if want := []string{"master-test-1a", "master-test-1b", "master-test-1c", "nodes"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("default instance groups = %v, want %v", names, want)
+	}
+	if want := []string{"test-1a-private"}; !reflect.DeepEqual(groups[0].Subnets, want) {
+		t.Errorf("airgapped master subnets = %v, want %v", groups[0].Subnets, want)
+	}
+	if want := privateSubnetNames("test-1"); !reflect.DeepEqual(groups[3].Subnets, want) {
+		t.Errorf("nodes subnets = %v, want %v", groups[3].Subnets, want)
+	}
+
+	// etcd cannot keep quorum without a master in each template zone
+	if _, err := defaultInstanceGroups(provider, "test-2", false); err == nil {
+		t.Error("placed the default masters in a zone that is not opted in")
+	}
+}
+
+func TestValidateInstanceGroupsMasterMinimum(t *testing.T) {
+	groups, err := defaultInstanceGroups(testZoneProvider(), "test-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Region: "test-1", InstanceGroups: groups}
+	if err := validateInstanceGroups(config); err != nil {
+		t.Fatalf("default instance groups: %v", err)
+	}
+
+	config.InstanceGroups[0].MinSize = 0
+	if err := validateInstanceGroups(config); err == nil || !strings.Contains(err.Error(), "master-test-1a") {
+		t.Errorf("master scaled to zero: got error %v", err)
+	}
+}
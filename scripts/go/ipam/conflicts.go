@@ -0,0 +1,119 @@
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Network is an address range the VPC must not overlap, such as a peered
+// VPC, a transit gateway attachment or an on-premises range.
+type Network struct {
+	Name string `yaml:"name"`
+	CIDR string `yaml:"cidr"`
+}
+
+// Relation describes how one CIDR block relates to another, phrased so that
+// it reads "a <relation> b".
+type Relation string
+
+const (
+	RelationDisjoint Relation = "is disjoint from"
+	RelationEqual    Relation = "is identical to"
+	RelationContains Relation = "contains"
+	RelationWithin   Relation = "is within"
+)
+
+// Compare reports how a relates to b. Two prefixes either do not overlap
+// or one contains the other; prefixes of different address families are
+// always disjoint.
+func Compare(a, b netip.Prefix) Relation {
+	a, b = a.Masked(), b.Masked()
+	switch {
+	case !a.Overlaps(b):
+		return RelationDisjoint
+	case a == b:
+		return RelationEqual
+	case a.Bits() < b.Bits():
+		return RelationContains
+	default:
+		return RelationWithin
+	}
+}
+
+// Overlaps reports whether the CIDR blocks a and b share any address.
+func Overlaps(a, b netip.Prefix) bool {
+	return Compare(a, b) != RelationDisjoint
+}
+
+// Conflict is a network that overlaps the VPC, or a subnet of the VPC that
+// lies outside it or overlaps a network.
+type Conflict struct {
+	VPC      netip.Prefix
+	Subnet   Network // Unset for conflicts of the VPC itself
+	Network  Network
+	Relation Relation // Of the VPC or subnet to the network
+}
+
+func (c Conflict) String() string {
+	if c.Subnet != (Network{}) {
+		return fmt.Sprintf("subnet %s (%s) %s %s (%s)", c.Subnet.Name, c.Subnet.CIDR, c.Relation, c.Network.Name, c.Network.CIDR)
+	}
+	return fmt.Sprintf("VPC %s %s %s (%s)", c.VPC, c.Relation, c.Network.Name, c.Network.CIDR)
+}
+
+// CheckConflicts returns the networks that overlap vpcCIDR, in the order
+// given. Peered or routed networks that overlap the VPC cannot be reached
+// from it, so any conflict must be resolved before provisioning.
+func CheckConflicts(vpcCIDR string, networks []Network) ([]Conflict, error) {
+	vpc, err := netip.ParsePrefix(vpcCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VPC CIDR %q: %w", vpcCIDR, err)
+	}
+
+	var conflicts []Conflict
+	for _, network := range networks {
+		prefix, err := netip.ParsePrefix(network.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q for network %s: %w", network.CIDR, network.Name, err)
+		}
+		if relation := Compare(vpc, prefix); relation != RelationDisjoint {
+			conflicts = append(conflicts, Conflict{VPC: vpc.Masked(), Network: network, Relation: relation})
+		}
+	}
+	return conflicts, nil
+}
+
+// CheckSubnets returns the subnets that do not lie within vpcCIDR, and the
+// networks those subnets overlap. A subnet within the VPC can only overlap
+// a network the VPC overlaps too, which CheckConflicts reports.
+func CheckSubnets(vpcCIDR string, subnets, networks []Network) ([]Conflict, error) {
+	vpc, err := netip.ParsePrefix(vpcCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VPC CIDR %q: %w", vpcCIDR, err)
+	}
+	vpcNetwork := Network{Name: "VPC", CIDR: vpc.Masked().String()}
+
+	var conflicts []Conflict
+	for _, subnet := range subnets {
+		prefix, err := netip.ParsePrefix(subnet.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q for subnet %s: %w", subnet.CIDR, subnet.Name, err)
+		}
+		relation := Compare(prefix, vpc)
+		if relation == RelationWithin || relation == RelationEqual {
+			continue
+		}
+		conflicts = append(conflicts, Conflict{VPC: vpc.Masked(), Subnet: subnet, Network: vpcNetwork, Relation: relation})
+
+		for _, network := range networks {
+			peer, err := netip.ParsePrefix(network.CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q for network %s: %w", network.CIDR, network.Name, err)
+			}
+			if relation := Compare(prefix, peer); relation != RelationDisjoint {
+				conflicts = append(conflicts, Conflict{VPC: vpc.Masked(), Subnet: subnet, Network: network, Relation: relation})
+			}
+		}
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,249 @@
+// Package ipam carves a VPC CIDR into subnet tiers per availability zone.
+//
+// Each tier gets one aligned block sized for every current and reserved
+// availability zone, so adding an AZ later never moves existing subnets.
+// Blocks are allocated largest first from the start of the VPC CIDR, which
+// keeps every block aligned without leaving holes between them.
+package ipam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"sort"
+)
+
+// Tier is a class of subnets with the same routing and exposure.
+type Tier string
+
+const (
+	TierPublic   Tier = "public"   // Load balancers and NAT gateways; routed to the internet gateway
+	TierPrivate  Tier = "private"  // Cluster nodes; outbound through NAT
+	TierIntra    Tier = "intra"    // No route outside the VPC
+	TierDatabase Tier = "database" // Data stores; no route outside the VPC
+)
+
+// Tiers lists all tiers in allocation order.
+var Tiers = []Tier{TierPublic, TierPrivate, TierIntra, TierDatabase}
+
+// AWS limits on VPC and subnet sizes.
+const (
+	MinVPCPrefix    = 16
+	MaxSubnetPrefix = 28
+	IPv6VPCPrefix   = 56
+	IPv6SubnetBits  = 64
+)
+
+// Layout describes how to carve a VPC into subnets.
+type Layout struct {
+	VPCCIDR           string
+	IPv6CIDR          string   // Amazon-provided /56; optional
+	AvailabilityZones []string // One subnet per tier in each zone
+	ReservedAZs       int      // Zones to keep address space for
+	Prefixes          map[Tier]int
+}
+
+// DefaultPrefixes returns the prefix length of each tier when none is
+// configured. Tiers with a zero prefix length are not allocated.
+func DefaultPrefixes() map[Tier]int {
+	return map[Tier]int{
+		TierPublic:  24,
+		TierPrivate: 20,
+	}
+}
+
+// Subnet is one allocated subnet.
+type Subnet struct {
+	Tier             Tier
+	AvailabilityZone string
+	CIDR             netip.Prefix
+	IPv6CIDR         netip.Prefix // Invalid when the layout has no IPv6 CIDR
+}
+
+// Allocation is the result of carving a VPC.
+type Allocation struct {
+	VPC      netip.Prefix
+	IPv6     netip.Prefix
+	Subnets  []Subnet // Ordered by tier, then availability zone
+	Blocks   map[Tier]netip.Prefix
+	Reserved []Subnet // Address space kept for future zones; AvailabilityZone is empty
+}
+
+// Allocate carves the VPC CIDR of layout into subnets.
+func Allocate(layout Layout) (*Allocation, error) {
+	vpc, err := netip.ParsePrefix(layout.VPCCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VPC CIDR %q: %w", layout.VPCCIDR, err)
+	}
+	if !vpc.Addr().Is4() {
+		return nil, fmt.Errorf("VPC CIDR %s must be an IPv4 block", vpc)
+	}
+	if vpc != vpc.Masked() {
+		return nil, fmt.Errorf("VPC CIDR %s has host bits set; did you mean %s?", vpc, vpc.Masked())
+	}
+	if vpc.Bits() < MinVPCPrefix || vpc.Bits() > MaxSubnetPrefix {
+		return nil, fmt.Errorf("VPC CIDR %s must be between /%d and /%d", vpc, MinVPCPrefix, MaxSubnetPrefix)
+	}
+	if len(layout.AvailabilityZones) == 0 {
+		return nil, fmt.Errorf("no availability zones to allocate subnets in")
+	}
+	if layout.ReservedAZs < 0 {
+		return nil, fmt.Errorf("reserved availability zones cannot be negative")
+	}
+
+	prefixes := layout.Prefixes
+	if prefixes == nil {
+		prefixes = DefaultPrefixes()
+	}
+	var tiers []Tier
+	for _, tier := range Tiers {
+		prefix := prefixes[tier]
+		if prefix == 0 {
+			continue
+		}
+		if prefix < vpc.Bits() || prefix > MaxSubnetPrefix {
+			return nil, fmt.Errorf("%s subnets must be between /%d and /%d, got /%d", tier, vpc.Bits(), MaxSubnetPrefix, prefix)
+		}
+		tiers = append(tiers, tier)
+	}
+	for tier := range prefixes {
+		if !knownTier(tier) {
+			return nil, fmt.Errorf("unknown subnet tier %q", tier)
+		}
+	}
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("no subnet tiers to allocate")
+	}
+
+	// Every tier block holds a power of two subnets, one per slot.
+	slots := len(layout.AvailabilityZones) + layout.ReservedAZs
+	slotBits := bits.Len(uint(slots - 1))
+
+	// Allocate the largest blocks first; sort is stable, so equal blocks
+	// keep tier order.
+	ordered := append([]Tier(nil), tiers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return prefixes[ordered[i]] < prefixes[ordered[j]]
+	})
+
+	allocation := &Allocation{VPC: vpc, Blocks: make(map[Tier]netip.Prefix)}
+	base := uint64(addrToUint32(vpc.Addr()))
+	end := base + 1<<(32-vpc.Bits())
+	next := base
+	for _, tier := range ordered {
+		blockBits := prefixes[tier] - slotBits
+		if blockBits < vpc.Bits() {
+			return nil, fmt.Errorf("%d /%d %s subnets do not fit in VPC CIDR %s", slots, prefixes[tier], tier, vpc)
+		}
+		size := uint64(1) << (32 - blockBits)
+		if next+size > end {
+			return nil, fmt.Errorf("VPC CIDR %s is too small for the %s tier: %d /%d subnets need a /%d block",
+				vpc, tier, slots, prefixes[tier], blockBits)
+		}
+		allocation.Blocks[tier] = netip.PrefixFrom(uint32ToAddr(uint32(next)), blockBits)
+		next += size
+	}
+
+	var ipv6 netip.Prefix
+	if layout.IPv6CIDR != "" {
+		ipv6, err = netip.ParsePrefix(layout.IPv6CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPv6 CIDR %q: %w", layout.IPv6CIDR, err)
+		}
+		if !ipv6.Addr().Is6() || ipv6.Addr().Is4In6() {
+			return nil, fmt.Errorf("IPv6 CIDR %s must be an IPv6 block", ipv6)
+		}
+		if ipv6.Bits() != IPv6VPCPrefix || ipv6 != ipv6.Masked() {
+			return nil, fmt.Errorf("IPv6 CIDR %s must be a /%d network", ipv6, IPv6VPCPrefix)
+		}
+		if available := 1 << (IPv6SubnetBits - IPv6VPCPrefix); len(tiers)*slots > available {
+			return nil, fmt.Errorf("%d IPv6 subnets do not fit in %s, which holds %d /%d subnets",
+				len(tiers)*slots, ipv6, available, IPv6SubnetBits)
+		}
+		allocation.IPv6 = ipv6
+	}
+
+	// IPv6 /64s are numbered in tier order, leaving room for reserved zones.
+	for t, tier := range tiers {
+		block := allocation.Blocks[tier]
+		size := uint32(1) << (32 - prefixes[tier])
+		for slot := 0; slot < slots; slot++ {
+			subnet := Subnet{
+				Tier: tier,
+				CIDR: netip.PrefixFrom(uint32ToAddr(addrToUint32(block.Addr())+uint32(slot)*size), prefixes[tier]),
+			}
+			if ipv6.IsValid() {
+				subnet.IPv6CIDR = ipv6Subnet(ipv6, uint64(t*slots+slot))
+			}
+			if slot < len(layout.AvailabilityZones) {
+				subnet.AvailabilityZone = layout.AvailabilityZones[slot]
+				allocation.Subnets = append(allocation.Subnets, subnet)
+			} else {
+				allocation.Reserved = append(allocation.Reserved, subnet)
+			}
+		}
+	}
+	return allocation, nil
+}
+
+// Tier returns the subnets of tier ordered by availability zone.
+func (a *Allocation) Tier(tier Tier) []Subnet {
+	var subnets []Subnet
+	for _, subnet := range a.Subnets {
+		if subnet.Tier == tier {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets
+}
+
+// CIDRs returns the IPv4 CIDRs of tier ordered by availability zone.
+func (a *Allocation) CIDRs(tier Tier) []string {
+	var cidrs []string
+	for _, subnet := range a.Tier(tier) {
+		cidrs = append(cidrs, subnet.CIDR.String())
+	}
+	return cidrs
+}
+
+// IPv6CIDRs returns the IPv6 CIDRs of tier ordered by availability zone, or
+// nil when the layout has no IPv6 CIDR.
+func (a *Allocation) IPv6CIDRs(tier Tier) []string {
+	if !a.IPv6.IsValid() {
+		return nil
+	}
+	var cidrs []string
+	for _, subnet := range a.Tier(tier) {
+		cidrs = append(cidrs, subnet.IPv6CIDR.String())
+	}
+	return cidrs
+}
+
+func knownTier(tier Tier) bool {
+	for _, known := range Tiers {
+		if tier == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ipv6Subnet returns the index-th /64 of block.
+func ipv6Subnet(block netip.Prefix, index uint64) netip.Prefix {
+	addr := block.Addr().As16()
+	network := binary.BigEndian.Uint64(addr[:8]) + index
+	binary.BigEndian.PutUint64(addr[:8], network)
+	return netip.PrefixFrom(netip.AddrFrom16(addr), IPv6SubnetBits)
+}
+
+func addrToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func uint32ToAddr(value uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], value)
+	return netip.AddrFrom4(b)
+}
@@ -1,25 +1,63 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"aegis-k8s-framework/ipam"
+)
+
+const (
+	terraformDir = "../../terraform"
+	kopsDir      = "../../kops"
 )
 
 type Config struct {
-	Environment     string
-	Region          string
-	ClusterName     string
-	StateBucket     string
-	VpcCidr         string
-	PublicSubnets   []string
-	PrivateSubnets  []string
+	Environment     string          `yaml:"environment"`
+	Region          string          `yaml:"region"`
+	ClusterName     string          `yaml:"clusterName"`
+	StateBucket     string          `yaml:"stateBucket"`
+	VpcCidr         string          `yaml:"vpcCidr"`
+	PublicSubnets   []string        `yaml:"publicSubnets"`
+	PrivateSubnets  []string        `yaml:"privateSubnets"`
+	SubnetLayout    SubnetLayout    `yaml:"subnetLayout"`
+	PeeredNetworks  []ipam.Network  `yaml:"peeredNetworks"`
+	LocalZoneGroups []string        `yaml:"localZoneGroups"` // Opted-in local zone groups, such as us-east-1-bos-1
+	InstanceGroups  []InstanceGroup `yaml:"instanceGroups"`
+	Airgapped       bool            `yaml:"airgapped"` // Private-only networking; see renderSubnets
+}
+
+// SubnetLayout sizes the subnets carved from the VPC CIDR when publicSubnets
+// or privateSubnets are not set explicitly. Without a layout the subnets
+// default to defaultPublicSubnets and defaultPrivateSubnets.
+type SubnetLayout struct {
+	PublicPrefix  int  `yaml:"publicPrefix,omitempty"`
+	PrivatePrefix int  `yaml:"privatePrefix,omitempty"`
+	ReservedAZs   *int `yaml:"reservedAzs,omitempty"` // Defaults to 1
 }
 
+// defaultReservedAZs keeps address space for one more availability zone.
+const defaultReservedAZs = 1
+
+// Subnets used when neither the subnets nor a subnetLayout are configured;
+// the same as the defaults in terraform/variables.tf.
+var (
+	defaultPublicSubnets  = []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"}
+	defaultPrivateSubnets = []string{"10.0.10.0/24", "10.0.11.0/24", "10.0.12.0/24"}
+)
+
+var configPath string
+
 var rootCmd = &cobra.Command{
 	Use:   "aegis",
 	Short: "Aegis Kubernetes Framework CLI",
@@ -31,6 +69,8 @@ var provisionCmd = &cobra.Command{
 	Short: "Provision infrastructure and cluster",
 	Run: func(cmd *cobra.Command, args []string) {
 		config := loadConfig()
+		checkNetworkConflicts(config)
+		checkZonePlacement(config)
 		provisionInfrastructure(config)
 		provisionCluster(config)
 	},
@@ -47,6 +87,9 @@ var destroyCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", getEnvOrDefault("AEGIS_CONFIG", "aegis.yaml"),
+		"Path to the Aegis config file")
+
 	rootCmd.AddCommand(provisionCmd)
 	rootCmd.AddCommand(destroyCmd)
 }
@@ -58,16 +101,185 @@ func main() {
 	}
 }
 
+// loadConfig builds the effective configuration from the --config file and
+// the environment.
 func loadConfig() Config {
-	return Config{
-		Environment:    getEnvOrDefault("AEGIS_ENVIRONMENT", "staging"),
-		Region:         getEnvOrDefault("AWS_REGION", "us-east-1"),
-		ClusterName:    getEnvOrDefault("CLUSTER_NAME", "staging.cluster.aegis.local"),
-		StateBucket:    getEnvOrDefault("KOPS_STATE_BUCKET", ""),
-		VpcCidr:        getEnvOrDefault("VPC_CIDR", "10.0.0.0/16"),
-		PublicSubnets:  []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"},
-		PrivateSubnets: []string{"10.0.10.0/24", "10.0.11.0/24", "10.0.12.0/24"},
+	config, err := loadConfigFrom(configPath, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return config
+}
+
+// noEnvironment is passed to loadConfigFrom for config files that describe
+// another environment, which the overrides of this shell must not change.
+func noEnvironment(string) string {
+	return ""
+}
+
+// loadConfigFrom builds the effective configuration. Values from the config
+// file at path take precedence over built-in defaults, and the environment
+// variables returned by getenv take precedence over both.
+func loadConfigFrom(path string, getenv func(string) string) (Config, error) {
+	file, err := readConfigFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	override := func(key, value string) string {
+		if env := getenv(key); env != "" {
+			return env
+		}
+		return value
+	}
+	config := Config{
+		Environment:    override("AEGIS_ENVIRONMENT", valueOrDefault(file.Environment, "staging")),
+		Region:         override("AWS_REGION", valueOrDefault(file.Region, "us-east-1")),
+		ClusterName:    override("CLUSTER_NAME", valueOrDefault(file.ClusterName, "staging.cluster.aegis.local")),
+		StateBucket:    override("KOPS_STATE_BUCKET", file.StateBucket),
+		VpcCidr:        override("VPC_CIDR", valueOrDefault(file.VpcCidr, "10.0.0.0/16")),
+		PublicSubnets:  file.PublicSubnets,
+		PrivateSubnets: file.PrivateSubnets,
+		InstanceGroups: file.InstanceGroups,
+	}
+	config.SubnetLayout = file.SubnetLayout
+	config.PeeredNetworks = file.PeeredNetworks
+	config.LocalZoneGroups = file.LocalZoneGroups
+	config.Airgapped = file.Airgapped
+	if (len(config.PublicSubnets) == 0 || len(config.PrivateSubnets) == 0) && config.SubnetLayout == (SubnetLayout{}) {
+		if len(config.PublicSubnets) == 0 {
+			config.PublicSubnets = defaultPublicSubnets
+		}
+		if len(config.PrivateSubnets) == 0 {
+			config.PrivateSubnets = defaultPrivateSubnets
+		}
+	}
+	if len(config.PublicSubnets) == 0 || len(config.PrivateSubnets) == 0 {
+		allocation, err := allocateSubnets(config)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to allocate subnets: %w", err)
+		}
+		if len(config.PublicSubnets) == 0 {
+			config.PublicSubnets = allocation.CIDRs(ipam.TierPublic)
+		}
+		if len(config.PrivateSubnets) == 0 {
+			config.PrivateSubnets = allocation.CIDRs(ipam.TierPrivate)
+		}
+	}
+	if len(config.InstanceGroups) == 0 {
+		groups, err := defaultInstanceGroups(templateProvider{}, config.Region, config.Airgapped)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to place the default instance groups: %w", err)
+		}
+		config.InstanceGroups = groups
+	}
+	return config, nil
+}
+
+// allocateSubnets carves the VPC CIDR into public and private subnets in the
+// zones the kops cluster template places them in.
+func allocateSubnets(config Config) (*ipam.Allocation, error) {
+	prefixes := ipam.DefaultPrefixes()
+	if config.SubnetLayout.PublicPrefix != 0 {
+		prefixes[ipam.TierPublic] = config.SubnetLayout.PublicPrefix
+	}
+	if config.SubnetLayout.PrivatePrefix != 0 {
+		prefixes[ipam.TierPrivate] = config.SubnetLayout.PrivatePrefix
+	}
+	reserved := defaultReservedAZs
+	if config.SubnetLayout.ReservedAZs != nil {
+		reserved = *config.SubnetLayout.ReservedAZs
+	}
+
+	return ipam.Allocate(ipam.Layout{
+		VPCCIDR:           config.VpcCidr,
+		AvailabilityZones: templateZones(config.Region),
+		ReservedAZs:       reserved,
+		Prefixes:          prefixes,
+	})
+}
+
+// readConfigFile parses the YAML config file at path. A missing file is not
+// an error; it yields an empty Config so that defaults apply.
+func readConfigFile(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, err
 	}
+	return config, nil
+}
+
+// saveInstanceGroups replaces the instanceGroups of the config file at path
+// with groups. The rest of the file is written back as it was, so defaults
+// and environment variable overrides never end up in the file.
+func saveInstanceGroups(path string, groups []InstanceGroup) error {
+	var document yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	if document.Kind == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected a mapping at the top level", path)
+	}
+
+	var value yaml.Node
+	if err := value.Encode(groups); err != nil {
+		return err
+	}
+	replaced := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "instanceGroups" {
+			root.Content[i+1] = &value
+			replaced = true
+		}
+	}
+	if !replaced {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "instanceGroups"}, &value)
+	}
+
+	data, err = marshalYAML(&document)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// marshalYAML encodes value with the two-space indentation used by the kops
+// manifests in this repository.
+func marshalYAML(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value != "" {
+		return value
+	}
+	return defaultValue
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -81,15 +293,94 @@ func provisionInfrastructure(config Config) {
 	fmt.Println("Provisioning infrastructure with Terraform...")
 
 	cmd := exec.Command("terraform", "init")
-	cmd.Dir = "../../terraform"
+	cmd.Dir = terraformDir
 	runCommand(cmd)
 
-	cmd = exec.Command("terraform", "apply", "-auto-approve",
+	cmd = exec.Command("terraform", append([]string{"apply", "-auto-approve"}, terraformVars(config)...)...)
+	cmd.Dir = terraformDir
+	runCommand(cmd)
+}
+
+// terraformVars returns the -var flags of every terraform run, so that drift
+// checks plan against the variables the infrastructure was applied with. The
+// subnets are the ones renderSubnets gives kops; kops finds the VPC and
+// subnets terraform created by the IDs in its outputs (see clusterNetwork).
+func terraformVars(config Config) []string {
+	return []string{
 		fmt.Sprintf("-var=environment=%s", config.Environment),
 		fmt.Sprintf("-var=region=%s", config.Region),
-		fmt.Sprintf("-var=state_bucket=%s", config.StateBucket))
-	cmd.Dir = "../../terraform"
-	runCommand(cmd)
+		fmt.Sprintf("-var=state_bucket=%s", config.StateBucket),
+		fmt.Sprintf("-var=vpc_cidr=%s", config.VpcCidr),
+		fmt.Sprintf("-var=availability_zones=%s", hclList(templateZones(config.Region))),
+		fmt.Sprintf("-var=public_subnets=%s", hclList(config.PublicSubnets)),
+		fmt.Sprintf("-var=private_subnets=%s", hclList(config.PrivateSubnets)),
+		fmt.Sprintf("-var=airgapped=%t", config.Airgapped),
+	}
+}
+
+// hclList formats values as an HCL list of strings for terraform -var.
+func hclList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return "[" + strings.Join(quoted, ",") + "]"
+}
+
+// terraformNetwork is the VPC and subnets terraform created, from its
+// outputs.
+type terraformNetwork struct {
+	VPCID            string
+	PublicSubnetIDs  []string
+	PrivateSubnetIDs []string
+}
+
+// clusterNetwork returns the VPC and subnets terraform created for the
+// cluster, or nil before terraform has been applied, in which case kops
+// creates a VPC of its own. Airgapped clusters reach AWS only through the
+// VPC endpoints terraform creates, so they always need the terraform VPC.
+func clusterNetwork(config Config) (*terraformNetwork, error) {
+	network, err := readTerraformNetwork()
+	switch {
+	case network != nil:
+		return network, nil
+	case config.Airgapped && err != nil:
+		return nil, fmt.Errorf("airgapped clusters need the VPC and endpoints terraform creates: %w", err)
+	case config.Airgapped:
+		return nil, fmt.Errorf("airgapped clusters need the VPC and endpoints terraform creates; run 'aegis provision' first")
+	}
+	return nil, nil
+}
+
+func readTerraformNetwork() (*terraformNetwork, error) {
+	cmd := exec.Command("terraform", "output", "-json")
+	cmd.Dir = terraformDir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("terraform output: %w", err)
+	}
+	return parseTerraformNetwork(output)
+}
+
+// parseTerraformNetwork parses the output of 'terraform output -json',
+// returning nil when the outputs are empty because nothing was applied.
+func parseTerraformNetwork(data []byte) (*terraformNetwork, error) {
+	var outputs struct {
+		VPCID            struct{ Value string }   `json:"vpc_id"`
+		PublicSubnetIDs  struct{ Value []string } `json:"public_subnet_ids"`
+		PrivateSubnetIDs struct{ Value []string } `json:"private_subnet_ids"`
+	}
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, err
+	}
+	if outputs.VPCID.Value == "" {
+		return nil, nil
+	}
+	return &terraformNetwork{
+		VPCID:            outputs.VPCID.Value,
+		PublicSubnetIDs:  outputs.PublicSubnetIDs.Value,
+		PrivateSubnetIDs: outputs.PrivateSubnetIDs.Value,
+	}, nil
 }
 
 func provisionCluster(config Config) {
@@ -100,7 +391,7 @@ func provisionCluster(config Config) {
 
 	// Create cluster
 	cmd := exec.Command("kops", "create", "-f", "cluster.yaml")
-	cmd.Dir = "../../kops"
+	cmd.Dir = kopsDir
 	runCommand(cmd)
 
 	cmd = exec.Command("kops", "create", "secret", "--name", config.ClusterName, "sshpublickey", "admin", "-i", "~/.ssh/id_rsa.pub")
@@ -125,36 +416,134 @@ func destroyInfrastructure(config Config) {
 	fmt.Println("Destroying infrastructure...")
 
 	cmd := exec.Command("terraform", "destroy", "-auto-approve")
-	cmd.Dir = "../../terraform"
+	cmd.Dir = terraformDir
 	runCommand(cmd)
 }
 
 func generateClusterConfig(config Config) {
-	templatePath := "templates/cluster.yaml.template"
-	outputPath := "cluster.yaml"
+	outputPath := filepath.Join(kopsDir, "cluster.yaml")
 
-	template, err := os.ReadFile(templatePath)
+	network, err := clusterNetwork(config)
 	if err != nil {
 		log.Fatal(err)
 	}
+	content, err := renderClusterConfig(config, network)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = os.WriteFile(outputPath, []byte(content), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// renderClusterConfig fills the kops cluster template with values from config,
+// placing the cluster in network when it is not nil.
+func renderClusterConfig(config Config, network *terraformNetwork) (string, error) {
+	templatePath := filepath.Join(kopsDir, "templates", "cluster.yaml.template")
+
+	template, err := os.ReadFile(templatePath)
+	if err != nil {
+		return "", err
+	}
+
+	instanceGroups, err := renderInstanceGroups(config)
+	if err != nil {
+		return "", err
+	}
+	subnets, err := renderSubnets(config, network)
+	if err != nil {
+		return "", err
+	}
+	networkID := ""
+	if network != nil {
+		networkID = "\n  networkID: " + network.VPCID
+	}
+
+	apiLoadBalancer, mastersTopology := "Public", "public"
+	if config.Airgapped {
+		apiLoadBalancer, mastersTopology = "Internal", "private"
+	}
 
 	content := string(template)
+	content = strings.ReplaceAll(content, "{{INSTANCE_GROUPS}}", instanceGroups)
+	content = strings.ReplaceAll(content, "{{SUBNETS}}", subnets)
+	content = strings.ReplaceAll(content, "{{API_LOAD_BALANCER_TYPE}}", apiLoadBalancer)
+	content = strings.ReplaceAll(content, "{{MASTERS_TOPOLOGY}}", mastersTopology)
 	content = strings.ReplaceAll(content, "{{CLUSTER_NAME}}", config.ClusterName)
 	content = strings.ReplaceAll(content, "{{KOPS_STATE_BUCKET}}", config.StateBucket)
 	content = strings.ReplaceAll(content, "{{ENVIRONMENT}}", config.Environment)
 	content = strings.ReplaceAll(content, "{{REGION}}", config.Region)
 	content = strings.ReplaceAll(content, "{{VPC_CIDR}}", config.VpcCidr)
-	content = strings.ReplaceAll(content, "{{PUBLIC_SUBNET_1}}", config.PublicSubnets[0])
-	content = strings.ReplaceAll(content, "{{PUBLIC_SUBNET_2}}", config.PublicSubnets[1])
-	content = strings.ReplaceAll(content, "{{PUBLIC_SUBNET_3}}", config.PublicSubnets[2])
-	content = strings.ReplaceAll(content, "{{PRIVATE_SUBNET_1}}", config.PrivateSubnets[0])
-	content = strings.ReplaceAll(content, "{{PRIVATE_SUBNET_2}}", config.PrivateSubnets[1])
-	content = strings.ReplaceAll(content, "{{PRIVATE_SUBNET_3}}", config.PrivateSubnets[2])
+	content = strings.ReplaceAll(content, "{{NETWORK_ID}}", networkID)
 
-	err = os.WriteFile(outputPath, []byte(content), 0644)
+	return content, nil
+}
+
+// kopsSubnet mirrors a subnet of the kops Cluster resource.
+type kopsSubnet struct {
+	CIDR   string `yaml:"cidr"`
+	Egress string `yaml:"egress,omitempty"`
+	ID     string `yaml:"id,omitempty"`
+	Name   string `yaml:"name"`
+	Type   string `yaml:"type"`
+	Zone   string `yaml:"zone"`
+}
+
+// renderSubnets renders the subnets of the cluster spec: a public and a
+// private subnet in each template zone. In the terraform network the subnets
+// are shared by ID and terraform owns their routes, so kops manages no
+// egress. Airgapped clusters have no way to the internet: terraform creates
+// no public subnets, the masters move to the private subnets behind an
+// internal API load balancer, and the private subnets reach AWS through the
+// VPC endpoints.
+func renderSubnets(config Config, network *terraformNetwork) (string, error) {
+	zoneNames := templateZones(config.Region)
+	if (!config.Airgapped && len(config.PublicSubnets) < len(zoneNames)) || len(config.PrivateSubnets) < len(zoneNames) {
+		return "", fmt.Errorf("the cluster template needs a public and a private subnet in each of %s",
+			strings.Join(zoneNames, ", "))
+	}
+	if config.Airgapped && network == nil {
+		return "", fmt.Errorf("airgapped clusters must be placed in the VPC terraform creates, not one kops creates")
+	}
+
+	var publicIDs, privateIDs []string
+	privateEgress := ""
+	if network != nil {
+		publicIDs, privateIDs, privateEgress = network.PublicSubnetIDs, network.PrivateSubnetIDs, "External"
+		if (!config.Airgapped && len(publicIDs) < len(zoneNames)) || len(privateIDs) < len(zoneNames) {
+			return "", fmt.Errorf("terraform created %d public and %d private subnets, the cluster template needs one of each in %s",
+				len(publicIDs), len(privateIDs), strings.Join(zoneNames, ", "))
+		}
+	}
+	subnetID := func(ids []string, i int) string {
+		if ids == nil {
+			return ""
+		}
+		return ids[i]
+	}
+
+	subnets := make([]kopsSubnet, 0, 2*len(zoneNames))
+	if !config.Airgapped {
+		for i, zone := range zoneNames {
+			subnets = append(subnets, kopsSubnet{CIDR: config.PublicSubnets[i], ID: subnetID(publicIDs, i), Name: zone, Type: "Public", Zone: zone})
+		}
+	}
+	for i, zone := range zoneNames {
+		subnets = append(subnets, kopsSubnet{CIDR: config.PrivateSubnets[i], Egress: privateEgress, ID: subnetID(privateIDs, i), Name: zone + "-private", Type: "Private", Zone: zone})
+	}
+
+	data, err := marshalYAML(subnets)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
+	}
+	// Indented as a list under spec
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i := range lines {
+		lines[i] = "  " + lines[i]
 	}
+	return strings.Join(lines, "\n"), nil
 }
 
 func runCommand(cmd *exec.Cmd) {
@@ -163,4 +552,4 @@ func runCommand(cmd *exec.Cmd) {
 	if err := cmd.Run(); err != nil {
 		log.Fatalf("Command failed: %v", err)
 	}
-}
\ No newline at end of file
+}
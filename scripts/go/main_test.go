@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigSubnets(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		wantPublic  []string
+		wantPrivate []string
+	}{
+		{
+			name:        "defaults match terraform",
+			file:        "environment: staging\n",
+			wantPublic:  []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"},
+			wantPrivate: []string{"10.0.10.0/24", "10.0.11.0/24", "10.0.12.0/24"},
+		},
+		{
+			name:        "carved with a subnet layout",
+			file:        "subnetLayout:\n  publicPrefix: 24\n  privatePrefix: 20\n",
+			wantPublic:  []string{"10.0.64.0/24", "10.0.65.0/24", "10.0.66.0/24"},
+			wantPrivate: []string{"10.0.0.0/20", "10.0.16.0/20", "10.0.32.0/20"},
+		},
+		{
+			name:        "explicit subnets",
+			file:        "publicSubnets: [10.0.4.0/24]\nprivateSubnets: [10.0.20.0/24]\n",
+			wantPublic:  []string{"10.0.4.0/24"},
+			wantPrivate: []string{"10.0.20.0/24"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "aegis.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := loadConfigFrom(path, noEnvironment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config.PublicSubnets, tt.wantPublic) {
+				t.Errorf("PublicSubnets = %v, want %v", config.PublicSubnets, tt.wantPublic)
+			}
+			if !reflect.DeepEqual(config.PrivateSubnets, tt.wantPrivate) {
+				t.Errorf("PrivateSubnets = %v, want %v", config.PrivateSubnets, tt.wantPrivate)
+			}
+		})
+	}
+}
+
+func TestHCLList(t *testing.T) {
+	if got, want := hclList([]string{"10.0.1.0/24", "10.0.2.0/24"}), `["10.0.1.0/24","10.0.2.0/24"]`; got != want {
+		t.Errorf("hclList() = %s, want %s", got, want)
+	}
+}
+
+func TestTerraformVars(t *testing.T) {
+	config := Config{
+		Environment:    "staging",
+		Region:         "us-east-1",
+		StateBucket:    "aegis-state",
+		VpcCidr:        "10.0.0.0/16",
+		PublicSubnets:  []string{"10.0.1.0/24"},
+		PrivateSubnets: []string{"10.0.10.0/24"},
+		Airgapped:      true,
+	}
+	want := []string{
+		"-var=environment=staging",
+		"-var=region=us-east-1",
+		"-var=state_bucket=aegis-state",
+		"-var=vpc_cidr=10.0.0.0/16",
+		`-var=availability_zones=["us-east-1a","us-east-1b","us-east-1c"]`,
+		`-var=public_subnets=["10.0.1.0/24"]`,
+		`-var=private_subnets=["10.0.10.0/24"]`,
+		"-var=airgapped=true",
+	}
+	if got := terraformVars(config); !reflect.DeepEqual(got, want) {
+		t.Errorf("terraformVars() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadConfigOutsideZoneCatalog(t *testing.T) {
+	// The zone catalog has no us-west-1a; only placing groups checks it
+	path := filepath.Join(t.TempDir(), "aegis.yaml")
+	if err := os.WriteFile(path, []byte("environment: staging\nregion: us-west-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfigFrom(path, noEnvironment)
+	if err != nil {
+		t.Fatalf("loading a us-west-1 config: %v", err)
+	}
+	if len(config.InstanceGroups) != 4 {
+		t.Errorf("default instance groups = %v", config.InstanceGroups)
+	}
+
+	if check := checkAvailabilityZones(config); check.Status != doctorWarn {
+		t.Errorf("doctor zone check = %s %s, want a warning", check.Status, check.Message)
+	}
+}
+
+func TestParseTerraformNetwork(t *testing.T) {
+	network, err := parseTerraformNetwork([]byte(`{
+  "vpc_id": {"sensitive": false, "type": "string", "value": "vpc-123"},
+  "public_subnet_ids": {"sensitive": false, "type": ["list", "string"], "value": []},
+  "private_subnet_ids": {"sensitive": false, "type": ["list", "string"], "value": ["subnet-a", "subnet-b"]}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &terraformNetwork{VPCID: "vpc-123", PublicSubnetIDs: []string{}, PrivateSubnetIDs: []string{"subnet-a", "subnet-b"}}
+	if !reflect.DeepEqual(network, want) {
+		t.Errorf("parseTerraformNetwork() = %+v, want %+v", network, want)
+	}
+
+	// Nothing has been applied yet
+	if network, err := parseTerraformNetwork([]byte("{}\n")); err != nil || network != nil {
+		t.Errorf("parseTerraformNetwork({}) = %+v, %v; want no network", network, err)
+	}
+}
+
+func TestRenderClusterConfigNetwork(t *testing.T) {
+	config := Config{
+		Environment:    "staging",
+		Region:         "us-east-1",
+		ClusterName:    "staging.cluster.aegis.local",
+		VpcCidr:        "10.0.0.0/16",
+		PublicSubnets:  defaultPublicSubnets,
+		PrivateSubnets: defaultPrivateSubnets,
+	}
+	groups, err := defaultInstanceGroups(templateProvider{}, config.Region, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.InstanceGroups = groups
+	network := &terraformNetwork{
+		VPCID:            "vpc-123",
+		PublicSubnetIDs:  []string{"subnet-pub-a", "subnet-pub-b", "subnet-pub-c"},
+		PrivateSubnetIDs: []string{"subnet-priv-a", "subnet-priv-b", "subnet-priv-c"},
+	}
+
+	clusterSpec := func(t *testing.T, config Config, network *terraformNetwork) map[string]interface{} {
+		t.Helper()
+		content, err := renderClusterConfig(config, network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		documents, err := decodeYAMLDocuments(content)
+		if err != nil {
+			t.Fatalf("rendered cluster spec does not parse: %v", err)
+		}
+		return documents[0]["spec"].(map[string]interface{})
+	}
+	subnetField := func(spec map[string]interface{}, field string) []interface{} {
+		var values []interface{}
+		for _, subnet := range spec["subnets"].([]interface{}) {
+			values = append(values, subnet.(map[string]interface{})[field])
+		}
+		return values
+	}
+
+	t.Run("kops-managed VPC before terraform", func(t *testing.T) {
+		spec := clusterSpec(t, config, nil)
+		if _, ok := spec["networkID"]; ok {
+			t.Errorf("networkID rendered without a terraform network")
+		}
+		if ids := subnetField(spec, "id"); !reflect.DeepEqual(ids, []interface{}{nil, nil, nil, nil, nil, nil}) {
+			t.Errorf("subnet ids = %v, want none", ids)
+		}
+	})
+
+	t.Run("terraform VPC", func(t *testing.T) {
+		spec := clusterSpec(t, config, network)
+		if spec["networkID"] != "vpc-123" {
+			t.Errorf("networkID = %v, want vpc-123", spec["networkID"])
+		}
+		want := []interface{}{"subnet-pub-a", "subnet-pub-b", "subnet-pub-c", "subnet-priv-a", "subnet-priv-b", "subnet-priv-c"}
+		if ids := subnetField(spec, "id"); !reflect.DeepEqual(ids, want) {
+			t.Errorf("subnet ids = %v, want %v", ids, want)
+		}
+		if egress := subnetField(spec, "egress"); !reflect.DeepEqual(egress, []interface{}{nil, nil, nil, "External", "External", "External"}) {
+			t.Errorf("subnet egress = %v", egress)
+		}
+	})
+
+	t.Run("airgapped", func(t *testing.T) {
+		airgapped := config
+		airgapped.Airgapped = true
+		airgapped.InstanceGroups, err = defaultInstanceGroups(templateProvider{}, config.Region, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := renderClusterConfig(airgapped, nil); err == nil {
+			t.Error("rendered an airgapped cluster into a kops-managed VPC")
+		}
+
+		network := *network
+		network.PublicSubnetIDs = []string{}
+		spec := clusterSpec(t, airgapped, &network)
+		if types := subnetField(spec, "type"); !reflect.DeepEqual(types, []interface{}{"Private", "Private", "Private"}) {
+			t.Errorf("airgapped subnet types = %v, want only private subnets", types)
+		}
+		if ids := subnetField(spec, "id"); !reflect.DeepEqual(ids, []interface{}{"subnet-priv-a", "subnet-priv-b", "subnet-priv-c"}) {
+			t.Errorf("airgapped subnet ids = %v", ids)
+		}
+	})
+}
@@ -0,0 +1,429 @@
+package netmodel
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"aegis-k8s-framework/ipam"
+)
+
+// Rule actions and directions, as used by EC2.
+const (
+	ActionAllow      = "allow"
+	ActionDeny       = "deny"
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+)
+
+// Protocols. Rules may also use the IANA protocol numbers.
+const (
+	ProtocolAll  = "-1"
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolICMP = "icmp"
+)
+
+var protocolNumbers = map[string]string{"6": ProtocolTCP, "17": ProtocolUDP, "1": ProtocolICMP}
+
+// EphemeralPorts is the client port range return traffic is sent to. It
+// covers the ranges used by Linux, Windows, NAT gateways and ELB.
+const EphemeralPorts = "1024-65535"
+
+// Rule numbering. Generated rules are numbered RuleNumberStep apart, so up
+// to RuleNumberStep-1 rules can be inserted between any two of them later.
+// Every generated ACL ends with an explicit deny-all rule at DenyAllRuleNumber,
+// ahead of the implicit rule AWS evaluates last.
+const (
+	RuleNumberStart    = 100
+	RuleNumberStep     = 100
+	MaxRuleNumber      = 32766
+	DenyAllRuleNumber  = 32000
+	ImplicitRuleNumber = 32767
+)
+
+// NACLRule is one entry of a network ACL. PortRange is a single port or a
+// "from-to" range, and empty for rules that apply to all ports.
+type NACLRule struct {
+	RuleNumber int
+	Protocol   string
+	PortRange  string
+	CidrBlock  string
+	RuleAction string
+	Direction  string
+}
+
+func (r NACLRule) String() string {
+	number := strconv.Itoa(r.RuleNumber)
+	if r.RuleNumber == ImplicitRuleNumber {
+		number = "*"
+	}
+	ports := r.PortRange
+	if ports == "" {
+		ports = "all"
+	}
+	return fmt.Sprintf("%s rule %s: %s %s %s port %s", r.Direction, number, r.RuleAction, r.Protocol, r.CidrBlock, ports)
+}
+
+// NACL is a network ACL and the subnets associated with it.
+type NACL struct {
+	ID      string
+	Tier    ipam.Tier
+	Subnets []string
+	Rules   []NACLRule
+}
+
+// implicitDeny is the rule AWS appends to every network ACL.
+func implicitDeny(direction string) NACLRule {
+	return NACLRule{
+		RuleNumber: ImplicitRuleNumber,
+		Protocol:   ProtocolAll,
+		CidrBlock:  "0.0.0.0/0",
+		RuleAction: ActionDeny,
+		Direction:  direction,
+	}
+}
+
+// GenerateNACLRules returns the network ACL rules for subnets of tier in
+// vpc. ACLs are stateless, so every allowed connection also has a rule
+// letting its return traffic back in or out on the ephemeral ports.
+//
+//   - public: HTTP and HTTPS from anywhere, everything from the VPC and its
+//     peered and transit networks, and return traffic from the internet for
+//     connections made by the subnet or through its NAT gateways
+//   - private: everything from the VPC and its peered and transit networks,
+//     HTTP and HTTPS out through NAT, and the return traffic for it
+//   - intra: traffic within the VPC only
+//   - database: traffic with private and database subnets only
+//
+// Rules are numbered with AllocateRuleNumbers.
+func GenerateNACLRules(vpc VPC, tier ipam.Tier) ([]NACLRule, error) {
+	if _, err := netip.ParsePrefix(vpc.CIDR); err != nil {
+		return nil, fmt.Errorf("invalid VPC CIDR %q: %w", vpc.CIDR, err)
+	}
+
+	var rules []NACLRule
+	allow := func(direction, protocol, ports, cidr string) {
+		rules = append(rules, NACLRule{Protocol: protocol, PortRange: ports, CidrBlock: cidr, RuleAction: ActionAllow, Direction: direction})
+	}
+	both := func(protocol, ports, cidr string) {
+		allow(DirectionIngress, protocol, ports, cidr)
+		allow(DirectionEgress, protocol, ports, cidr)
+	}
+
+	switch tier {
+	case ipam.TierPublic:
+		for _, cidr := range internalNetworks(vpc) {
+			both(ProtocolAll, "", cidr)
+		}
+		for _, port := range []string{"80", "443"} {
+			allow(DirectionIngress, ProtocolTCP, port, "0.0.0.0/0")
+			allow(DirectionEgress, ProtocolTCP, port, "0.0.0.0/0")
+		}
+		both(ProtocolTCP, EphemeralPorts, "0.0.0.0/0")
+	case ipam.TierPrivate:
+		for _, cidr := range internalNetworks(vpc) {
+			both(ProtocolAll, "", cidr)
+		}
+		allow(DirectionEgress, ProtocolTCP, "80", "0.0.0.0/0")
+		allow(DirectionEgress, ProtocolTCP, "443", "0.0.0.0/0")
+		allow(DirectionIngress, ProtocolTCP, EphemeralPorts, "0.0.0.0/0")
+	case ipam.TierIntra:
+		both(ProtocolAll, "", vpc.CIDR)
+	case ipam.TierDatabase:
+		for _, subnet := range vpc.Subnets {
+			if subnet.Tier == ipam.TierPrivate || subnet.Tier == ipam.TierDatabase {
+				both(ProtocolAll, "", subnet.CIDR)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown subnet tier %q", tier)
+	}
+
+	for _, direction := range []string{DirectionIngress, DirectionEgress} {
+		deny := implicitDeny(direction)
+		deny.RuleNumber = DenyAllRuleNumber
+		rules = append(rules, deny)
+	}
+	return AllocateRuleNumbers(rules)
+}
+
+// GenerateNACLs returns one network ACL per tier of vpc, associated with all
+// subnets of that tier.
+func GenerateNACLs(vpc VPC) ([]NACL, error) {
+	var nacls []NACL
+	for _, tier := range ipam.Tiers {
+		nacl := NACL{ID: fmt.Sprintf("acl-%s", tier), Tier: tier}
+		for _, subnet := range vpc.Subnets {
+			if subnet.Tier == tier {
+				nacl.Subnets = append(nacl.Subnets, subnet.ID)
+			}
+		}
+		if len(nacl.Subnets) == 0 {
+			continue
+		}
+		rules, err := GenerateNACLRules(vpc, tier)
+		if err != nil {
+			return nil, err
+		}
+		nacl.Rules = rules
+		nacls = append(nacls, nacl)
+	}
+	return nacls, nil
+}
+
+// internalNetworks returns the VPC CIDR and the networks reachable through
+// its peering connections and transit gateways.
+func internalNetworks(vpc VPC) []string {
+	networks := []string{vpc.CIDR}
+	for _, peering := range vpc.Peerings {
+		networks = append(networks, peering.PeerCIDR)
+	}
+	for _, tgw := range vpc.TransitGateways {
+		networks = append(networks, tgw.Routes...)
+	}
+	return networks
+}
+
+// AllocateRuleNumbers numbers the rules without a rule number in each
+// direction, in order, starting at RuleNumberStart and RuleNumberStep apart.
+// Rules that already have a number keep it and unnumbered rules are placed
+// after the last of them, so the result stays in evaluation order.
+func AllocateRuleNumbers(rules []NACLRule) ([]NACLRule, error) {
+	numbered := append([]NACLRule(nil), rules...)
+	next := map[string]int{DirectionIngress: RuleNumberStart, DirectionEgress: RuleNumberStart}
+	used := make(map[string]bool)
+	for _, rule := range numbered {
+		if rule.RuleNumber != 0 {
+			used[fmt.Sprintf("%s/%d", rule.Direction, rule.RuleNumber)] = true
+		}
+	}
+
+	for i, rule := range numbered {
+		if rule.RuleNumber != 0 {
+			if rule.RuleNumber >= next[rule.Direction] && rule.RuleNumber != DenyAllRuleNumber {
+				next[rule.Direction] = (rule.RuleNumber/RuleNumberStep + 1) * RuleNumberStep
+			}
+			continue
+		}
+		number := next[rule.Direction]
+		for used[fmt.Sprintf("%s/%d", rule.Direction, number)] {
+			number += RuleNumberStep
+		}
+		if number >= DenyAllRuleNumber {
+			return nil, fmt.Errorf("no rule number left for %s", rule)
+		}
+		numbered[i].RuleNumber = number
+		used[fmt.Sprintf("%s/%d", rule.Direction, number)] = true
+		next[rule.Direction] = number + RuleNumberStep
+	}
+	return numbered, nil
+}
+
+// InsertRule adds rule to rules so that it is evaluated directly before the
+// rule numbered before, numbering it halfway into the gap between that rule
+// and the one preceding it in the same direction.
+func InsertRule(rules []NACLRule, rule NACLRule, before int) ([]NACLRule, error) {
+	previous, found := 0, false
+	for _, existing := range rules {
+		if existing.Direction != rule.Direction {
+			continue
+		}
+		if existing.RuleNumber == before {
+			found = true
+		} else if existing.RuleNumber < before && existing.RuleNumber > previous {
+			previous = existing.RuleNumber
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no %s rule numbered %d", rule.Direction, before)
+	}
+	if before-previous < 2 {
+		return nil, fmt.Errorf("no gap between %s rules %d and %d", rule.Direction, previous, before)
+	}
+
+	rule.RuleNumber = previous + (before-previous)/2
+	return append(append([]NACLRule(nil), rules...), rule), nil
+}
+
+// Evaluate returns the rule that decides traffic in direction between the
+// subnet and remote, and whether it is allowed. Rules are evaluated in rule
+// number order and the first match wins; traffic no rule matches is denied
+// by the implicit rule. For ICMP the port is ignored.
+func (n NACL) Evaluate(direction string, remote netip.Addr, protocol string, port int) (NACLRule, bool) {
+	rules := append([]NACLRule(nil), n.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].RuleNumber < rules[j].RuleNumber })
+
+	for _, rule := range rules {
+		if rule.Direction == direction && rule.matches(remote, protocol, port) {
+			return rule, rule.RuleAction == ActionAllow
+		}
+	}
+	return implicitDeny(direction), false
+}
+
+func (r NACLRule) matches(addr netip.Addr, protocol string, port int) bool {
+	cidr, err := netip.ParsePrefix(r.CidrBlock)
+	if err != nil || !cidr.Contains(addr) {
+		return false
+	}
+	ruleProtocol := NormalizeProtocol(r.Protocol)
+	if ruleProtocol == ProtocolAll {
+		return true
+	}
+	if ruleProtocol != NormalizeProtocol(protocol) {
+		return false
+	}
+	if ruleProtocol == ProtocolICMP || r.PortRange == "" {
+		return true
+	}
+	from, to, err := ParsePortRange(r.PortRange)
+	return err == nil && port >= from && port <= to
+}
+
+// NormalizeProtocol returns the name of a protocol given by name or IANA
+// number, and ProtocolAll for "-1" or "all".
+func NormalizeProtocol(protocol string) string {
+	protocol = strings.ToLower(protocol)
+	if name, ok := protocolNumbers[protocol]; ok {
+		return name
+	}
+	if protocol == "all" {
+		return ProtocolAll
+	}
+	return protocol
+}
+
+// ParsePortRange parses a single port or a "from-to" range.
+func ParsePortRange(ports string) (int, int, error) {
+	fromText, toText, isRange := strings.Cut(ports, "-")
+	if !isRange {
+		toText = fromText
+	}
+	from, err := strconv.Atoi(strings.TrimSpace(fromText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q", ports)
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(toText))
+	if err != nil || from < 0 || to > 65535 || from > to {
+		return 0, 0, fmt.Errorf("invalid port range %q", ports)
+	}
+	return from, to, nil
+}
+
+// NACLFor returns the network ACL associated with subnetID.
+func NACLFor(nacls []NACL, subnetID string) (NACL, bool) {
+	for _, nacl := range nacls {
+		for _, id := range nacl.Subnets {
+			if id == subnetID {
+				return nacl, true
+			}
+		}
+	}
+	return NACL{}, false
+}
+
+// Flow is a connection from Source to Destination on a destination port.
+// SourcePort is the client port return traffic is sent to; zero means a
+// typical ephemeral port. The security groups of each end are only checked
+// by Network.Trace, and only for ends that have any.
+type Flow struct {
+	Source            netip.Addr
+	Destination       netip.Addr
+	Protocol          string
+	Port              int
+	SourcePort        int
+	SourceGroups      []string
+	DestinationGroups []string
+}
+
+// defaultSourcePort is the start of the Linux ephemeral port range.
+const defaultSourcePort = 32768
+
+func (f Flow) String() string {
+	return fmt.Sprintf("%s -> %s %s/%d", f.Source, f.Destination, f.Protocol, f.Port)
+}
+
+// NACLDecision is the rule one network ACL applied to one leg of a flow.
+type NACLDecision struct {
+	NACL      string
+	Subnet    string
+	Direction string
+	Return    bool // Return traffic from the destination to the source
+	Rule      NACLRule
+	Allowed   bool
+}
+
+func (d NACLDecision) String() string {
+	leg := "request"
+	if d.Return {
+		leg = "return"
+	}
+	verdict := "allowed"
+	if !d.Allowed {
+		verdict = "denied"
+	}
+	return fmt.Sprintf("%s %s by %s (%s)", leg, verdict, d.NACL, d.Rule)
+}
+
+// EvaluateFlow checks flow against the network ACLs of the source and
+// destination subnets: the request leaving the source and entering the
+// destination, and the return traffic back to the source port. It returns
+// every decision made and whether all of them allowed the flow. ACLs do not
+// apply within a subnet, and addresses outside the VPC have no ACL.
+func EvaluateFlow(vpc VPC, nacls []NACL, flow Flow) ([]NACLDecision, bool) {
+	source, sourceInVPC := vpc.SubnetFor(flow.Source)
+	destination, destinationInVPC := vpc.SubnetFor(flow.Destination)
+	if sourceInVPC && destinationInVPC && source.ID == destination.ID {
+		return nil, true
+	}
+	sourcePort := flow.SourcePort
+	if sourcePort == 0 {
+		sourcePort = defaultSourcePort
+	}
+
+	type leg struct {
+		subnet    Subnet
+		inVPC     bool
+		direction string
+		remote    netip.Addr
+		port      int
+		isReturn  bool
+	}
+	legs := []leg{
+		{source, sourceInVPC, DirectionEgress, flow.Destination, flow.Port, false},
+		{destination, destinationInVPC, DirectionIngress, flow.Source, flow.Port, false},
+		{destination, destinationInVPC, DirectionEgress, flow.Source, sourcePort, true},
+		{source, sourceInVPC, DirectionIngress, flow.Destination, sourcePort, true},
+	}
+
+	var decisions []NACLDecision
+	allowed := true
+	for _, l := range legs {
+		if !l.inVPC {
+			continue
+		}
+		decision := evaluateLeg(nacls, l.subnet, l.direction, l.remote, flow.Protocol, l.port, l.isReturn)
+		decisions = append(decisions, decision)
+		allowed = allowed && decision.Allowed
+	}
+	return decisions, allowed
+}
+
+// evaluateLeg evaluates one direction of traffic at the network ACL of
+// subnet. Subnets without an ACL use the default ACL, which allows everything.
+func evaluateLeg(nacls []NACL, subnet Subnet, direction string, remote netip.Addr, protocol string, port int, isReturn bool) NACLDecision {
+	decision := NACLDecision{Subnet: subnet.ID, Direction: direction, Return: isReturn}
+	nacl, ok := NACLFor(nacls, subnet.ID)
+	if !ok {
+		decision.NACL = "default"
+		decision.Rule = NACLRule{RuleNumber: RuleNumberStart, Protocol: ProtocolAll, CidrBlock: "0.0.0.0/0", RuleAction: ActionAllow, Direction: direction}
+		decision.Allowed = true
+		return decision
+	}
+	decision.NACL = nacl.ID
+	decision.Rule, decision.Allowed = nacl.Evaluate(direction, remote, protocol, port)
+	return decision
+}
@@ -0,0 +1,255 @@
+package netmodel
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Network is a VPC with its route tables, network ACLs and security groups.
+type Network struct {
+	VPC            VPC
+	RouteTables    []RouteTable
+	NACLs          []NACL
+	SecurityGroups []SecurityGroup
+}
+
+// Generate returns the network terraform/modules/vpc creates for vpc. It has
+// no security groups; those belong to the cluster, not the VPC.
+func Generate(vpc VPC) (Network, error) {
+	tables, err := GenerateRouteTables(vpc)
+	if err != nil {
+		return Network{}, err
+	}
+	nacls, err := GenerateNACLs(vpc)
+	if err != nil {
+		return Network{}, err
+	}
+	return Network{VPC: vpc, RouteTables: tables, NACLs: nacls}, nil
+}
+
+// Kinds of hops in a trace.
+const (
+	HopSecurityGroup = "security-group"
+	HopNetworkACL    = "network-acl"
+	HopRouteTable    = "route-table"
+	HopGateway       = "gateway"
+)
+
+// Hop is one component a flow passes through and what it decided.
+type Hop struct {
+	Kind    string
+	ID      string
+	Allowed bool
+	Detail  string
+}
+
+func (h Hop) String() string {
+	verdict := "allow"
+	if !h.Allowed {
+		verdict = "deny"
+	}
+	return fmt.Sprintf("[%s] %s %s: %s", verdict, h.Kind, h.ID, h.Detail)
+}
+
+// Trace is the path of a flow through the network, up to the first
+// component that denies it.
+type Trace struct {
+	Flow    Flow
+	Allowed bool
+	Hops    []Hop
+}
+
+// Reason explains the outcome: the hop that denied the flow, or "allowed".
+func (t Trace) Reason() string {
+	if t.Allowed || len(t.Hops) == 0 {
+		return "allowed"
+	}
+	return t.Hops[len(t.Hops)-1].String()
+}
+
+func (t Trace) String() string {
+	var b strings.Builder
+	verdict := "allowed"
+	if !t.Allowed {
+		verdict = "denied"
+	}
+	fmt.Fprintf(&b, "%s: %s\n", t.Flow, verdict)
+	for i, hop := range t.Hops {
+		fmt.Fprintf(&b, "  %d. %s\n", i+1, hop)
+	}
+	return b.String()
+}
+
+// Trace follows flow through the network and reports whether it is allowed,
+// along with every route, network ACL and security group decision on the
+// way. At least one end of the flow must be in the VPC. Traffic leaving the
+// VPC through a transit gateway or peering connection is traced up to the
+// gateway.
+func (n Network) Trace(flow Flow) Trace {
+	trace := Trace{Flow: flow}
+	step := func(hop Hop) bool {
+		trace.Hops = append(trace.Hops, hop)
+		return hop.Allowed
+	}
+	aclStep := func(subnet Subnet, direction string, remote netip.Addr, port int, isReturn bool) bool {
+		decision := evaluateLeg(n.NACLs, subnet, direction, remote, flow.Protocol, port, isReturn)
+		return step(Hop{
+			Kind:    HopNetworkACL,
+			ID:      decision.NACL,
+			Allowed: decision.Allowed,
+			Detail:  fmt.Sprintf("%s at %s by %s", decisionVerdict(decision), subnet.ID, decision.Rule),
+		})
+	}
+
+	source, sourceInVPC := n.VPC.SubnetFor(flow.Source)
+	destination, destinationInVPC := n.VPC.SubnetFor(flow.Destination)
+	if !sourceInVPC && !destinationInVPC {
+		step(Hop{Kind: HopRouteTable, Detail: fmt.Sprintf("neither %s nor %s is in VPC %s", flow.Source, flow.Destination, n.VPC.CIDR)})
+		return trace
+	}
+	sameSubnet := sourceInVPC && destinationInVPC && source.ID == destination.ID
+	sourcePort := flow.SourcePort
+	if sourcePort == 0 {
+		sourcePort = defaultSourcePort
+	}
+
+	if len(flow.SourceGroups) > 0 && !step(n.securityGroupHop(DirectionEgress, flow.SourceGroups, flow.Destination, flow.DestinationGroups, flow)) {
+		return trace
+	}
+	if sourceInVPC && !sameSubnet && !aclStep(source, DirectionEgress, flow.Destination, flow.Port, false) {
+		return trace
+	}
+
+	// Routing: outbound from the source subnet, or inbound to the
+	// destination subnet, which needs a return route to the source
+	var nat *Subnet
+	if sourceInVPC {
+		hop, target := n.routeHop(source, flow.Destination)
+		if !step(hop) {
+			return trace
+		}
+		switch target.Type {
+		case TargetNATGateway:
+			gateway, ok := n.VPC.NATGateway(target.ID)
+			subnet, found := n.VPC.Subnet(gateway.SubnetID)
+			if !ok || !found {
+				step(Hop{Kind: HopGateway, ID: target.ID, Detail: "NAT gateway is not in a subnet of the VPC"})
+				return trace
+			}
+			nat = &subnet
+			if !aclStep(subnet, DirectionIngress, flow.Source, flow.Port, false) ||
+				!aclStep(subnet, DirectionEgress, flow.Destination, flow.Port, false) {
+				return trace
+			}
+			hop, target = n.routeHop(subnet, flow.Destination)
+			if !step(hop) {
+				return trace
+			}
+			if target.Type != TargetInternetGateway {
+				step(Hop{Kind: HopGateway, ID: gateway.ID, Detail: fmt.Sprintf("NAT gateway subnet %s routes %s to %s, not the internet gateway", subnet.ID, flow.Destination, target)})
+				return trace
+			}
+			step(Hop{Kind: HopGateway, ID: gateway.ID, Allowed: true, Detail: fmt.Sprintf("NAT gateway in %s translates the source address", subnet.ID)})
+			step(Hop{Kind: HopGateway, ID: target.ID, Allowed: true, Detail: "leaves the VPC through the internet gateway"})
+		case TargetInternetGateway:
+			step(Hop{Kind: HopGateway, ID: target.ID, Allowed: true, Detail: "leaves the VPC through the internet gateway"})
+		case TargetTransitGateway, TargetPeering:
+			step(Hop{Kind: HopGateway, ID: target.ID, Allowed: true, Detail: fmt.Sprintf("leaves the VPC through %s", target.Type)})
+		}
+	} else {
+		hop, target := n.routeHop(destination, flow.Source)
+		hop.Detail = "return route: " + hop.Detail
+		if !step(hop) {
+			return trace
+		}
+		switch target.Type {
+		case TargetInternetGateway:
+			step(Hop{Kind: HopGateway, ID: target.ID, Allowed: true, Detail: "enters the VPC through the internet gateway"})
+		case TargetTransitGateway, TargetPeering:
+			step(Hop{Kind: HopGateway, ID: target.ID, Allowed: true, Detail: fmt.Sprintf("enters the VPC through %s", target.Type)})
+		default:
+			step(Hop{Kind: HopGateway, ID: target.ID, Detail: fmt.Sprintf("%s does not accept connections from outside the VPC", target.Type)})
+			return trace
+		}
+	}
+
+	if destinationInVPC && !sameSubnet && !aclStep(destination, DirectionIngress, flow.Source, flow.Port, false) {
+		return trace
+	}
+	if len(flow.DestinationGroups) > 0 && !step(n.securityGroupHop(DirectionIngress, flow.DestinationGroups, flow.Source, flow.SourceGroups, flow)) {
+		return trace
+	}
+
+	// Network ACLs are stateless, so the return traffic must be allowed too
+	if !sameSubnet {
+		if destinationInVPC && !aclStep(destination, DirectionEgress, flow.Source, sourcePort, true) {
+			return trace
+		}
+		if nat != nil && (!aclStep(*nat, DirectionIngress, flow.Destination, sourcePort, true) ||
+			!aclStep(*nat, DirectionEgress, flow.Source, sourcePort, true)) {
+			return trace
+		}
+		if sourceInVPC && !aclStep(source, DirectionIngress, flow.Destination, sourcePort, true) {
+			return trace
+		}
+	}
+
+	trace.Allowed = true
+	return trace
+}
+
+// routeHop looks up the route subnet uses to reach addr.
+func (n Network) routeHop(subnet Subnet, addr netip.Addr) (Hop, Target) {
+	table, ok := RouteTableFor(n.RouteTables, subnet.ID)
+	if !ok {
+		return Hop{Kind: HopRouteTable, Detail: fmt.Sprintf("subnet %s has no route table", subnet.ID)}, Target{}
+	}
+	hop := Hop{Kind: HopRouteTable, ID: table.ID}
+	route, ok := table.Lookup(addr)
+	switch {
+	case !ok:
+		hop.Detail = fmt.Sprintf("no route to %s from %s", addr, subnet.ID)
+	case route.State == RouteBlackhole:
+		hop.Detail = fmt.Sprintf("%s matches blackhole route %s", addr, route)
+	case route.Target.Type == TargetVPCEndpoint:
+		hop.Detail = fmt.Sprintf("%s matches endpoint route %s", addr, route)
+	default:
+		hop.Allowed = true
+		hop.Detail = fmt.Sprintf("%s matches %s", addr, route)
+	}
+	return hop, route.Target
+}
+
+// securityGroupHop checks whether any of groups allows traffic in direction
+// with remote, a peer in remoteGroups.
+func (n Network) securityGroupHop(direction string, groups []string, remote netip.Addr, remoteGroups []string, flow Flow) Hop {
+	hop := Hop{Kind: HopSecurityGroup, ID: strings.Join(groups, ",")}
+	for _, id := range groups {
+		group, ok := SecurityGroupByID(n.SecurityGroups, id)
+		if !ok {
+			hop.ID = id
+			hop.Detail = "unknown security group"
+			return hop
+		}
+		if rule, allowed := group.Allows(direction, remote, remoteGroups, flow.Protocol, flow.Port); allowed {
+			hop.ID = id
+			hop.Allowed = true
+			hop.Detail = fmt.Sprintf("%s allowed by %s", direction, rule)
+			return hop
+		}
+	}
+	hop.Detail = fmt.Sprintf("no %s rule allows %s/%d with %s", direction, flow.Protocol, flow.Port, remote)
+	return hop
+}
+
+func decisionVerdict(decision NACLDecision) string {
+	leg := "request"
+	if decision.Return {
+		leg = "return traffic"
+	}
+	if decision.Allowed {
+		return leg + " allowed"
+	}
+	return leg + " denied"
+}
@@ -0,0 +1,205 @@
+package netmodel
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"aegis-k8s-framework/ipam"
+)
+
+// TargetType is the kind of resource a route sends traffic to.
+type TargetType string
+
+const (
+	TargetLocal           TargetType = "local"
+	TargetInternetGateway TargetType = "internet-gateway"
+	TargetNATGateway      TargetType = "nat-gateway"
+	TargetTransitGateway  TargetType = "transit-gateway"
+	TargetVPCEndpoint     TargetType = "vpc-endpoint"
+	TargetPeering         TargetType = "vpc-peering"
+)
+
+// targetPrefixes maps AWS resource ID prefixes to target types.
+var targetPrefixes = map[string]TargetType{
+	"igw-":  TargetInternetGateway,
+	"nat-":  TargetNATGateway,
+	"tgw-":  TargetTransitGateway,
+	"vpce-": TargetVPCEndpoint,
+	"pcx-":  TargetPeering,
+}
+
+// Target is where a route sends traffic.
+type Target struct {
+	Type TargetType
+	ID   string // Resource ID; "local" for the VPC route
+}
+
+// ParseTarget derives the target type from an AWS resource ID such as
+// igw-0abc or nat-0def.
+func ParseTarget(id string) (Target, error) {
+	if id == "local" {
+		return Target{Type: TargetLocal, ID: id}, nil
+	}
+	for prefix, targetType := range targetPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return Target{Type: targetType, ID: id}, nil
+		}
+	}
+	return Target{}, fmt.Errorf("unknown route target %q", id)
+}
+
+func (t Target) String() string {
+	return t.ID
+}
+
+// Route states, as reported by EC2.
+const (
+	RouteActive    = "active"
+	RouteBlackhole = "blackhole"
+)
+
+// Route is one route of a route table. Destination is a CIDR block, or the
+// prefix list ID of a gateway endpoint.
+type Route struct {
+	Destination string
+	Target      Target
+	State       string // RouteActive unless AWS reported the target gone
+}
+
+// IsDefault reports whether the route is the IPv4 default route.
+func (r Route) IsDefault() bool {
+	return r.Destination == "0.0.0.0/0"
+}
+
+func (r Route) String() string {
+	return fmt.Sprintf("%s -> %s", r.Destination, r.Target)
+}
+
+// RouteTable is a route table and the subnets associated with it.
+type RouteTable struct {
+	ID               string
+	Name             string
+	Tier             ipam.Tier
+	AvailabilityZone string   // Empty for tables shared across zones
+	Subnets          []string // Associated subnet IDs
+	Routes           []Route
+}
+
+// DefaultRoute returns the IPv4 default route.
+func (rt RouteTable) DefaultRoute() (Route, bool) {
+	for _, route := range rt.Routes {
+		if route.IsDefault() {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+// Lookup returns the route that traffic to addr takes: the most specific
+// CIDR route containing it. Prefix list routes are not matched.
+func (rt RouteTable) Lookup(addr netip.Addr) (Route, bool) {
+	var best Route
+	bestBits := -1
+	for _, route := range rt.Routes {
+		prefix, err := netip.ParsePrefix(route.Destination)
+		if err != nil || !prefix.Contains(addr) {
+			continue
+		}
+		if prefix.Bits() > bestBits {
+			best, bestBits = route, prefix.Bits()
+		}
+	}
+	return best, bestBits >= 0
+}
+
+// RouteTableFor returns the route table associated with subnetID.
+func RouteTableFor(tables []RouteTable, subnetID string) (RouteTable, bool) {
+	for _, table := range tables {
+		if slices.Contains(table.Subnets, subnetID) {
+			return table, true
+		}
+	}
+	return RouteTable{}, false
+}
+
+// GenerateRouteTables returns the route tables terraform/modules/vpc creates
+// for vpc:
+//   - one public table shared by all public subnets, with a default route to
+//     the internet gateway
+//   - one private table per private subnet, with a default route to the NAT
+//     gateway in the same zone, or the first NAT gateway when its zone has
+//     none; airgapped VPCs have no default route
+//   - one table per intra and database subnet without a default route
+//
+// Every table has the local route of the VPC, routes to the networks of each
+// transit gateway and peering, and routes to the prefix list of each gateway
+// endpoint.
+func GenerateRouteTables(vpc VPC) ([]RouteTable, error) {
+	if _, err := netip.ParsePrefix(vpc.CIDR); err != nil {
+		return nil, fmt.Errorf("invalid VPC CIDR %q: %w", vpc.CIDR, err)
+	}
+
+	shared := []Route{{Destination: vpc.CIDR, Target: Target{Type: TargetLocal, ID: "local"}, State: RouteActive}}
+	for _, tgw := range vpc.TransitGateways {
+		for _, cidr := range tgw.Routes {
+			shared = append(shared, Route{Destination: cidr, Target: Target{Type: TargetTransitGateway, ID: tgw.ID}, State: RouteActive})
+		}
+	}
+	for _, peering := range vpc.Peerings {
+		shared = append(shared, Route{Destination: peering.PeerCIDR, Target: Target{Type: TargetPeering, ID: peering.ID}, State: RouteActive})
+	}
+	for _, endpoint := range vpc.Endpoints {
+		if endpoint.Type == EndpointGateway {
+			shared = append(shared, Route{Destination: endpoint.PrefixListID, Target: Target{Type: TargetVPCEndpoint, ID: endpoint.ID}, State: RouteActive})
+		}
+	}
+	routes := func(extra ...Route) []Route {
+		return append(append([]Route(nil), shared...), extra...)
+	}
+
+	var tables []RouteTable
+	public := RouteTable{ID: "rtb-public", Name: "public-rt", Tier: ipam.TierPublic}
+	for _, subnet := range vpc.Subnets {
+		if subnet.Tier == ipam.TierPublic {
+			public.Subnets = append(public.Subnets, subnet.ID)
+		}
+	}
+	if len(public.Subnets) > 0 {
+		if vpc.InternetGatewayID == "" {
+			return nil, fmt.Errorf("public subnets need an internet gateway")
+		}
+		public.Routes = routes(Route{Destination: "0.0.0.0/0", Target: Target{Type: TargetInternetGateway, ID: vpc.InternetGatewayID}, State: RouteActive})
+		tables = append(tables, public)
+	}
+
+	counts := make(map[ipam.Tier]int)
+	for _, subnet := range vpc.Subnets {
+		if subnet.Tier == ipam.TierPublic {
+			continue
+		}
+		counts[subnet.Tier]++
+		table := RouteTable{
+			ID:               fmt.Sprintf("rtb-%s-%d", subnet.Tier, counts[subnet.Tier]),
+			Name:             fmt.Sprintf("%s-rt-%d", subnet.Tier, counts[subnet.Tier]),
+			Tier:             subnet.Tier,
+			AvailabilityZone: subnet.AvailabilityZone,
+			Subnets:          []string{subnet.ID},
+			Routes:           routes(),
+		}
+
+		if subnet.Tier == ipam.TierPrivate && !vpc.Airgapped {
+			nat, ok := vpc.natGatewayIn(subnet.AvailabilityZone)
+			if !ok && len(vpc.NATGateways) > 0 {
+				nat, ok = vpc.NATGateways[0], true
+			}
+			if !ok {
+				return nil, fmt.Errorf("private subnet %s needs a NAT gateway", subnet.ID)
+			}
+			table.Routes = append(table.Routes, Route{Destination: "0.0.0.0/0", Target: Target{Type: TargetNATGateway, ID: nat.ID}, State: RouteActive})
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
@@ -0,0 +1,87 @@
+package netmodel
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// SecurityGroup is a security group. Security groups are stateful: return
+// traffic of an allowed connection is always allowed, so only the egress
+// rules of the source and the ingress rules of the destination apply.
+type SecurityGroup struct {
+	ID      string
+	Name    string
+	Ingress []SecurityGroupRule
+	Egress  []SecurityGroupRule
+}
+
+// SecurityGroupRule allows traffic from or to either a CIDR block or the
+// members of another security group. PortRange is empty for all ports.
+type SecurityGroupRule struct {
+	Protocol    string
+	PortRange   string
+	CidrBlock   string
+	SourceGroup string // Security group ID; the peer group for egress rules
+	Description string
+}
+
+func (r SecurityGroupRule) String() string {
+	peer := r.CidrBlock
+	if r.SourceGroup != "" {
+		peer = r.SourceGroup
+	}
+	ports := r.PortRange
+	if ports == "" {
+		ports = "all"
+	}
+	return fmt.Sprintf("%s %s port %s", r.Protocol, peer, ports)
+}
+
+// AllowAllEgress is the egress rule of a new security group.
+var AllowAllEgress = SecurityGroupRule{Protocol: ProtocolAll, CidrBlock: "0.0.0.0/0", Description: "default egress"}
+
+// Allows returns the first rule of the group that allows traffic in
+// direction with remote, a peer with the given security groups.
+func (g SecurityGroup) Allows(direction string, remote netip.Addr, remoteGroups []string, protocol string, port int) (SecurityGroupRule, bool) {
+	rules := g.Ingress
+	if direction == DirectionEgress {
+		rules = g.Egress
+	}
+	for _, rule := range rules {
+		if rule.matches(remote, remoteGroups, protocol, port) {
+			return rule, true
+		}
+	}
+	return SecurityGroupRule{}, false
+}
+
+func (r SecurityGroupRule) matches(addr netip.Addr, groups []string, protocol string, port int) bool {
+	if r.SourceGroup != "" {
+		if !slices.Contains(groups, r.SourceGroup) {
+			return false
+		}
+	} else {
+		cidr, err := netip.ParsePrefix(r.CidrBlock)
+		if err != nil || !cidr.Contains(addr) {
+			return false
+		}
+	}
+	// Security group rules are allow rules; their protocol and ports match
+	// like those of an ACL rule
+	rule := NACLRule{Protocol: r.Protocol, PortRange: r.PortRange, CidrBlock: "0.0.0.0/0"}
+	if addr.Is6() {
+		rule.CidrBlock = "::/0"
+	}
+	return rule.matches(addr, protocol, port)
+}
+
+// SecurityGroupByID returns the security group with the given ID.
+func SecurityGroupByID(groups []SecurityGroup, id string) (SecurityGroup, bool) {
+	for _, group := range groups {
+		if group.ID == id {
+			return group, true
+		}
+	}
+	return SecurityGroup{}, false
+}
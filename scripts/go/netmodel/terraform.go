@@ -0,0 +1,632 @@
+package netmodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"aegis-k8s-framework/ipam"
+)
+
+// terraformShow is the part of the `terraform show -json` output LoadTerraform
+// reads. Plans have planned_values; state has values.
+type terraformShow struct {
+	PlannedValues *terraformValues `json:"planned_values"`
+	Values        *terraformValues `json:"values"`
+	Configuration struct {
+		RootModule terraformConfigModule `json:"root_module"`
+	} `json:"configuration"`
+}
+
+type terraformValues struct {
+	RootModule terraformModule `json:"root_module"`
+}
+
+type terraformModule struct {
+	Resources    []terraformResource `json:"resources"`
+	ChildModules []terraformModule   `json:"child_modules"`
+}
+
+type terraformResource struct {
+	Address string                 `json:"address"`
+	Mode    string                 `json:"mode"`
+	Type    string                 `json:"type"`
+	Name    string                 `json:"name"`
+	Index   json.RawMessage        `json:"index"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+type terraformConfigModule struct {
+	Resources   []terraformConfigResource `json:"resources"`
+	ModuleCalls map[string]struct {
+		Module terraformConfigModule `json:"module"`
+	} `json:"module_calls"`
+}
+
+type terraformConfigResource struct {
+	Address     string                 `json:"address"`
+	Mode        string                 `json:"mode"`
+	Expressions map[string]interface{} `json:"expressions"`
+}
+
+// routeTargets maps the target attributes of a route to target types.
+var routeTargets = map[string]TargetType{
+	"gateway_id":                TargetInternetGateway,
+	"nat_gateway_id":            TargetNATGateway,
+	"transit_gateway_id":        TargetTransitGateway,
+	"vpc_endpoint_id":           TargetVPCEndpoint,
+	"vpc_peering_connection_id": TargetPeering,
+}
+
+// LoadTerraformFile reads the output of `terraform show -json` for a plan
+// or state file from path; see LoadTerraform.
+func LoadTerraformFile(path string) (Network, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Network{}, err
+	}
+	defer file.Close()
+
+	network, err := LoadTerraform(file)
+	if err != nil {
+		return Network{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return network, nil
+}
+
+// LoadTerraform builds the network from the output of `terraform show -json`
+// for a plan or state file, from its aws_vpc, aws_subnet, aws_internet_gateway,
+// aws_nat_gateway, aws_vpc_endpoint, aws_route_table, aws_route,
+// aws_route_table_association, aws_network_acl, aws_network_acl_rule and
+// aws_network_acl_association resources.
+//
+// Resource IDs that are not known until apply are replaced by the resource
+// address, such as aws_subnet.public[0], and references between resources are
+// resolved from the configuration. Every route table gets the local route AWS
+// adds implicitly.
+func LoadTerraform(r io.Reader) (Network, error) {
+	var show terraformShow
+	if err := json.NewDecoder(r).Decode(&show); err != nil {
+		return Network{}, fmt.Errorf("invalid terraform JSON: %w", err)
+	}
+	values := show.PlannedValues
+	if values == nil {
+		values = show.Values
+	}
+	if values == nil {
+		return Network{}, fmt.Errorf("no planned_values or values; pass the output of terraform show -json")
+	}
+
+	loader := &terraformLoader{
+		instances:   make(map[string][]*terraformResource),
+		expressions: make(map[string]map[string]interface{}),
+	}
+	loader.addModule(values.RootModule)
+	loader.addConfig("", show.Configuration.RootModule)
+	return loader.network()
+}
+
+type terraformLoader struct {
+	resources   []*terraformResource
+	instances   map[string][]*terraformResource // By address without index
+	expressions map[string]map[string]interface{}
+}
+
+func (l *terraformLoader) addModule(module terraformModule) {
+	for i := range module.Resources {
+		resource := &module.Resources[i]
+		if resource.Mode != "managed" {
+			continue
+		}
+		l.resources = append(l.resources, resource)
+		key := resourceKey(resource.Address)
+		l.instances[key] = append(l.instances[key], resource)
+	}
+	for _, child := range module.ChildModules {
+		l.addModule(child)
+	}
+}
+
+func (l *terraformLoader) addConfig(prefix string, module terraformConfigModule) {
+	for _, resource := range module.Resources {
+		if resource.Mode == "managed" {
+			l.expressions[prefix+resource.Address] = resource.Expressions
+		}
+	}
+	for name, call := range module.ModuleCalls {
+		l.addConfig(prefix+"module."+name+".", call.Module)
+	}
+}
+
+func (l *terraformLoader) ofType(resourceType string) []*terraformResource {
+	var resources []*terraformResource
+	for _, resource := range l.resources {
+		if resource.Type == resourceType {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+func (l *terraformLoader) network() (Network, error) {
+	vpcs := l.ofType("aws_vpc")
+	if len(vpcs) != 1 {
+		return Network{}, fmt.Errorf("found %d aws_vpc resources, need exactly one", len(vpcs))
+	}
+	network := Network{VPC: VPC{CIDR: stringValue(vpcs[0].Values, "cidr_block")}}
+	vpc := &network.VPC
+	if vpc.CIDR == "" {
+		return Network{}, fmt.Errorf("%s has no known cidr_block", vpcs[0].Address)
+	}
+
+	for _, resource := range l.ofType("aws_subnet") {
+		tags := mapValue(resource.Values, "tags")
+		subnet := Subnet{
+			ID:               resourceID(resource),
+			Name:             stringValue(tags, "Name"),
+			CIDR:             stringValue(resource.Values, "cidr_block"),
+			AvailabilityZone: stringValue(resource.Values, "availability_zone"),
+			Tier:             subnetTier(resource, tags),
+		}
+		if subnet.Name == "" {
+			subnet.Name = resource.Address
+		}
+		vpc.Subnets = append(vpc.Subnets, subnet)
+	}
+	// Terraform orders resources by address; order subnets like the generators
+	sort.SliceStable(vpc.Subnets, func(i, j int) bool {
+		return tierOrder(vpc.Subnets[i].Tier) < tierOrder(vpc.Subnets[j].Tier)
+	})
+	for _, resource := range l.ofType("aws_internet_gateway") {
+		vpc.InternetGatewayID = resourceID(resource)
+	}
+	for _, resource := range l.ofType("aws_nat_gateway") {
+		nat := NATGateway{ID: resourceID(resource)}
+		if ids := l.reference(resource, resource.Values, l.expressions[resourceKey(resource.Address)], "subnet_id"); len(ids) > 0 {
+			nat.SubnetID = ids[0]
+			if subnet, ok := vpc.Subnet(nat.SubnetID); ok {
+				nat.AvailabilityZone = subnet.AvailabilityZone
+			}
+		}
+		vpc.NATGateways = append(vpc.NATGateways, nat)
+	}
+	for _, resource := range l.ofType("aws_vpc_endpoint") {
+		endpoint := Endpoint{
+			ID:           resourceID(resource),
+			Service:      stringValue(resource.Values, "service_name"),
+			Type:         stringValue(resource.Values, "vpc_endpoint_type"),
+			PrefixListID: stringValue(resource.Values, "prefix_list_id"),
+		}
+		if endpoint.Type == "" {
+			endpoint.Type = EndpointGateway
+		}
+		vpc.Endpoints = append(vpc.Endpoints, endpoint)
+	}
+	// Without an internet gateway, AWS is only reachable through the endpoints
+	vpc.Airgapped = vpc.InternetGatewayID == "" && len(vpc.Endpoints) > 0
+
+	if err := l.routeTables(&network); err != nil {
+		return Network{}, err
+	}
+	if err := l.networkACLs(&network); err != nil {
+		return Network{}, err
+	}
+	sort.SliceStable(network.RouteTables, func(i, j int) bool {
+		return tierOrder(network.RouteTables[i].Tier) < tierOrder(network.RouteTables[j].Tier)
+	})
+	sort.SliceStable(network.NACLs, func(i, j int) bool {
+		return tierOrder(network.NACLs[i].Tier) < tierOrder(network.NACLs[j].Tier)
+	})
+	return network, nil
+}
+
+func (l *terraformLoader) routeTables(network *Network) error {
+	vpc := &network.VPC
+	index := make(map[string]int)
+	for _, resource := range l.ofType("aws_route_table") {
+		table := RouteTable{
+			ID:     resourceID(resource),
+			Name:   stringValue(mapValue(resource.Values, "tags"), "Name"),
+			Routes: []Route{{Destination: vpc.CIDR, Target: Target{Type: TargetLocal, ID: "local"}, State: RouteActive}},
+		}
+		expressions := l.expressions[resourceKey(resource.Address)]
+		blocks := listValue(expressions, "route")
+		routes := listValue(resource.Values, "route")
+		if routes == nil {
+			// Routes with unknown targets; take them from the configuration
+			routes = make([]interface{}, len(blocks))
+		}
+		for i, value := range routes {
+			values, _ := value.(map[string]interface{})
+			var block map[string]interface{}
+			if i < len(blocks) {
+				block, _ = blocks[i].(map[string]interface{})
+			}
+			route, err := l.route(resource, values, block)
+			if err != nil {
+				return err
+			}
+			table.Routes = append(table.Routes, route)
+		}
+		index[table.ID] = len(network.RouteTables)
+		network.RouteTables = append(network.RouteTables, table)
+	}
+
+	for _, resource := range l.ofType("aws_route") {
+		expressions := l.expressions[resourceKey(resource.Address)]
+		tables := l.reference(resource, resource.Values, expressions, "route_table_id")
+		if len(tables) == 0 {
+			return fmt.Errorf("%s: cannot resolve route_table_id", resource.Address)
+		}
+		i, ok := index[tables[0]]
+		if !ok {
+			return fmt.Errorf("%s: route table %s is not in the plan", resource.Address, tables[0])
+		}
+		route, err := l.route(resource, resource.Values, expressions)
+		if err != nil {
+			return err
+		}
+		network.RouteTables[i].Routes = append(network.RouteTables[i].Routes, route)
+	}
+
+	// Gateway endpoints route the prefix list of their service in each of
+	// their route tables
+	for _, resource := range l.ofType("aws_vpc_endpoint") {
+		endpoint, ok := vpc.endpoint(resourceID(resource))
+		if !ok || endpoint.Type != EndpointGateway {
+			continue
+		}
+		destination := endpoint.PrefixListID
+		if destination == "" {
+			destination = endpoint.Service // Until the prefix list is known
+		}
+		expressions := l.expressions[resourceKey(resource.Address)]
+		for _, id := range l.reference(resource, resource.Values, expressions, "route_table_ids") {
+			if i, ok := index[id]; ok {
+				network.RouteTables[i].Routes = append(network.RouteTables[i].Routes,
+					Route{Destination: destination, Target: Target{Type: TargetVPCEndpoint, ID: endpoint.ID}, State: RouteActive})
+			}
+		}
+	}
+
+	for _, resource := range l.ofType("aws_route_table_association") {
+		expressions := l.expressions[resourceKey(resource.Address)]
+		tables := l.reference(resource, resource.Values, expressions, "route_table_id")
+		subnets := l.reference(resource, resource.Values, expressions, "subnet_id")
+		if len(tables) == 0 || len(subnets) == 0 {
+			continue // Gateway associations
+		}
+		if i, ok := index[tables[0]]; ok {
+			network.RouteTables[i].Subnets = append(network.RouteTables[i].Subnets, subnets[0])
+		}
+	}
+
+	for i := range network.RouteTables {
+		table := &network.RouteTables[i]
+		table.Tier, table.AvailabilityZone = associatedTier(*vpc, table.Subnets)
+		for _, route := range table.Routes {
+			switch route.Target.Type {
+			case TargetTransitGateway:
+				vpc.addTransitGatewayRoute(route.Target.ID, route.Destination)
+			case TargetPeering:
+				vpc.addPeering(route.Target.ID, route.Destination)
+			}
+		}
+	}
+	return nil
+}
+
+// route builds a route from the values of an inline route block or an
+// aws_route resource, resolving unknown targets from the configuration.
+func (l *terraformLoader) route(resource *terraformResource, values, expressions map[string]interface{}) (Route, error) {
+	route := Route{State: RouteActive}
+	for _, attribute := range []string{"cidr_block", "destination_cidr_block", "destination_prefix_list_id", "ipv6_cidr_block", "destination_ipv6_cidr_block"} {
+		if route.Destination == "" {
+			route.Destination = stringValue(values, attribute)
+		}
+		if route.Destination == "" {
+			route.Destination = constantValue(expressions, attribute)
+		}
+	}
+
+	attributes := make([]string, 0, len(routeTargets))
+	for attribute := range routeTargets {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+	for _, attribute := range attributes {
+		ids := l.reference(resource, values, expressions, attribute)
+		if len(ids) == 0 {
+			continue
+		}
+		route.Target = Target{Type: routeTargets[attribute], ID: ids[0]}
+		// gateway_id also takes gateway endpoints
+		if target, err := ParseTarget(ids[0]); err == nil && attribute == "gateway_id" {
+			route.Target = target
+		}
+		break
+	}
+	if route.Destination == "" || route.Target.ID == "" {
+		return Route{}, fmt.Errorf("%s: route without a known destination and target", resource.Address)
+	}
+	if stringValue(values, "state") == RouteBlackhole {
+		route.State = RouteBlackhole
+	}
+	return route, nil
+}
+
+func (l *terraformLoader) networkACLs(network *Network) error {
+	vpc := &network.VPC
+	index := make(map[string]int)
+	for _, resource := range l.ofType("aws_network_acl") {
+		nacl := NACL{ID: resourceID(resource)}
+		nacl.Subnets = l.reference(resource, resource.Values, l.expressions[resourceKey(resource.Address)], "subnet_ids")
+		for _, direction := range []string{DirectionIngress, DirectionEgress} {
+			for _, entry := range listValue(resource.Values, direction) {
+				values, _ := entry.(map[string]interface{})
+				nacl.Rules = append(nacl.Rules, terraformNACLRule(values, direction, "rule_no", "action"))
+			}
+		}
+		index[nacl.ID] = len(network.NACLs)
+		network.NACLs = append(network.NACLs, nacl)
+	}
+
+	for _, resource := range l.ofType("aws_network_acl_rule") {
+		ids := l.reference(resource, resource.Values, l.expressions[resourceKey(resource.Address)], "network_acl_id")
+		i, ok := -1, false
+		if len(ids) > 0 {
+			i, ok = index[ids[0]]
+		}
+		if !ok {
+			return fmt.Errorf("%s: cannot resolve network_acl_id", resource.Address)
+		}
+		direction := DirectionIngress
+		if egress, _ := resource.Values["egress"].(bool); egress {
+			direction = DirectionEgress
+		}
+		network.NACLs[i].Rules = append(network.NACLs[i].Rules, terraformNACLRule(resource.Values, direction, "rule_number", "rule_action"))
+	}
+
+	for _, resource := range l.ofType("aws_network_acl_association") {
+		expressions := l.expressions[resourceKey(resource.Address)]
+		ids := l.reference(resource, resource.Values, expressions, "network_acl_id")
+		subnets := l.reference(resource, resource.Values, expressions, "subnet_id")
+		if len(ids) == 0 || len(subnets) == 0 {
+			return fmt.Errorf("%s: cannot resolve network_acl_id and subnet_id", resource.Address)
+		}
+		if i, ok := index[ids[0]]; ok {
+			network.NACLs[i].Subnets = append(network.NACLs[i].Subnets, subnets[0])
+		}
+	}
+
+	for i := range network.NACLs {
+		nacl := &network.NACLs[i]
+		nacl.Tier, _ = associatedTier(*vpc, nacl.Subnets)
+		sort.SliceStable(nacl.Rules, func(a, b int) bool {
+			if nacl.Rules[a].Direction != nacl.Rules[b].Direction {
+				return nacl.Rules[a].Direction == DirectionIngress
+			}
+			return nacl.Rules[a].RuleNumber < nacl.Rules[b].RuleNumber
+		})
+	}
+	return nil
+}
+
+func terraformNACLRule(values map[string]interface{}, direction, numberAttribute, actionAttribute string) NACLRule {
+	rule := NACLRule{
+		RuleNumber: int(numberValue(values, numberAttribute)),
+		Protocol:   NormalizeProtocol(stringValue(values, "protocol")),
+		CidrBlock:  stringValue(values, "cidr_block"),
+		RuleAction: stringValue(values, actionAttribute),
+		Direction:  direction,
+	}
+	if rule.CidrBlock == "" {
+		rule.CidrBlock = stringValue(values, "ipv6_cidr_block")
+	}
+	from, to := int(numberValue(values, "from_port")), int(numberValue(values, "to_port"))
+	switch {
+	case rule.Protocol == ProtocolAll || rule.Protocol == ProtocolICMP:
+	case from == to:
+		rule.PortRange = fmt.Sprint(from)
+	default:
+		rule.PortRange = fmt.Sprintf("%d-%d", from, to)
+	}
+	return rule
+}
+
+// referencePattern matches a resource address in a reference, such as
+// aws_subnet.public, aws_subnet.public[0] or module.vpc.aws_subnet.public.
+var referencePattern = regexp.MustCompile(`^((?:module\.[\w-]+\.)*[a-z0-9_]+\.[\w-]+)(\[[^\]]+\])?`)
+
+// reference returns the model IDs attribute refers to. A known value is
+// used as is; otherwise the references of its expression are resolved: to
+// the instance with the same index for count.index, to the indexed instance,
+// or to every instance of the resource.
+func (l *terraformLoader) reference(resource *terraformResource, values, expressions map[string]interface{}, attribute string) []string {
+	switch value := values[attribute].(type) {
+	case string:
+		if value != "" {
+			return []string{value}
+		}
+	case []interface{}:
+		var ids []string
+		for _, item := range value {
+			if id, ok := item.(string); ok && id != "" {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			return ids
+		}
+	}
+
+	expression, _ := expressions[attribute].(map[string]interface{})
+	references, _ := expression["references"].([]interface{})
+	usesCount := false
+	for _, reference := range references {
+		usesCount = usesCount || reference == "count.index"
+	}
+
+	prefix := modulePrefix(resource.Address)
+	for _, reference := range references {
+		text, _ := reference.(string)
+		if strings.HasPrefix(text, "var.") || strings.HasPrefix(text, "local.") ||
+			strings.HasPrefix(text, "count.") || strings.HasPrefix(text, "each.") || strings.HasPrefix(text, "data.") {
+			continue
+		}
+		match := referencePattern.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		instances := l.instances[prefix+match[1]]
+		if len(instances) == 0 {
+			continue
+		}
+		switch {
+		case match[2] != "" && match[2] != "[count.index]":
+			for _, instance := range instances {
+				if strings.HasSuffix(instance.Address, match[2]) {
+					return []string{resourceID(instance)}
+				}
+			}
+		case usesCount && len(resource.Index) > 0:
+			for _, instance := range instances {
+				if string(instance.Index) == string(resource.Index) {
+					return []string{resourceID(instance)}
+				}
+			}
+		default:
+			var ids []string
+			for _, instance := range instances {
+				ids = append(ids, resourceID(instance))
+			}
+			return ids
+		}
+	}
+	return nil
+}
+
+// associatedTier returns the tier the subnets share, and their zone when
+// there is a single subnet.
+func associatedTier(vpc VPC, subnetIDs []string) (ipam.Tier, string) {
+	var tier ipam.Tier
+	for i, id := range subnetIDs {
+		subnet, ok := vpc.Subnet(id)
+		if !ok {
+			return "", ""
+		}
+		if i > 0 && subnet.Tier != tier {
+			return "", ""
+		}
+		tier = subnet.Tier
+	}
+	if len(subnetIDs) == 1 {
+		subnet, _ := vpc.Subnet(subnetIDs[0])
+		return tier, subnet.AvailabilityZone
+	}
+	return tier, ""
+}
+
+// subnetTier takes the tier from the Type or Tier tag, or failing that from
+// the resource name.
+func subnetTier(resource *terraformResource, tags map[string]interface{}) ipam.Tier {
+	for _, candidate := range []string{stringValue(tags, "Type"), stringValue(tags, "Tier"), resource.Name} {
+		for _, tier := range ipam.Tiers {
+			if strings.EqualFold(candidate, string(tier)) {
+				return tier
+			}
+		}
+	}
+	return ""
+}
+
+// tierOrder is the position of tier in ipam.Tiers; unknown tiers sort last.
+func tierOrder(tier ipam.Tier) int {
+	for i, known := range ipam.Tiers {
+		if tier == known {
+			return i
+		}
+	}
+	return len(ipam.Tiers)
+}
+
+func (v *VPC) addTransitGatewayRoute(id, cidr string) {
+	for i := range v.TransitGateways {
+		if v.TransitGateways[i].ID == id {
+			v.TransitGateways[i].Routes = append(v.TransitGateways[i].Routes, cidr)
+			return
+		}
+	}
+	v.TransitGateways = append(v.TransitGateways, TransitGateway{ID: id, Routes: []string{cidr}})
+}
+
+func (v *VPC) addPeering(id, cidr string) {
+	for _, peering := range v.Peerings {
+		if peering.ID == id {
+			return
+		}
+	}
+	v.Peerings = append(v.Peerings, Peering{ID: id, PeerCIDR: cidr})
+}
+
+// resourceID is the ID of a resource, or its address until it is known.
+func resourceID(resource *terraformResource) string {
+	if id := stringValue(resource.Values, "id"); id != "" {
+		return id
+	}
+	return resource.Address
+}
+
+// resourceKey strips the instance index from an address, which may be a
+// for_each key with dots such as ["ecr.api"].
+func resourceKey(address string) string {
+	if i := strings.LastIndex(address, "["); i > 0 && strings.HasSuffix(address, "]") {
+		return address[:i]
+	}
+	return address
+}
+
+func modulePrefix(address string) string {
+	prefix := ""
+	for strings.HasPrefix(address, "module.") {
+		parts := strings.SplitN(address, ".", 3)
+		if len(parts) < 3 {
+			break
+		}
+		module := parts[0] + "." + parts[1] + "."
+		prefix += module
+		address = parts[2]
+	}
+	return prefix
+}
+
+func stringValue(values map[string]interface{}, key string) string {
+	value, _ := values[key].(string)
+	return value
+}
+
+func numberValue(values map[string]interface{}, key string) float64 {
+	value, _ := values[key].(float64)
+	return value
+}
+
+func mapValue(values map[string]interface{}, key string) map[string]interface{} {
+	value, _ := values[key].(map[string]interface{})
+	return value
+}
+
+func listValue(values map[string]interface{}, key string) []interface{} {
+	value, _ := values[key].([]interface{})
+	return value
+}
+
+// constantValue returns the constant string of an expression.
+func constantValue(expressions map[string]interface{}, key string) string {
+	expression, _ := expressions[key].(map[string]interface{})
+	value, _ := expression["constant_value"].(string)
+	return value
+}
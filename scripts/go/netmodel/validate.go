@@ -0,0 +1,169 @@
+package netmodel
+
+import (
+	"fmt"
+	"slices"
+
+	"aegis-k8s-framework/ipam"
+)
+
+// Route table checks reported by ValidateRouteTables.
+const (
+	CheckBlackhole         = "blackhole"
+	CheckDefaultRoute      = "missing-default-route"
+	CheckDefaultTarget     = "wrong-default-target"
+	CheckLocalRoute        = "missing-local-route"
+	CheckCrossAZNAT        = "cross-az-nat"
+	CheckUnassociated      = "unassociated-subnet"
+	CheckUnexpectedDefault = "unexpected-default-route"
+	CheckEndpointRoute     = "missing-endpoint-route"
+)
+
+// Problem is a route table misconfiguration.
+type Problem struct {
+	Check      string
+	RouteTable string
+	Message    string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Check, p.RouteTable, p.Message)
+}
+
+// ValidateRouteTables checks the route tables of vpc for:
+//   - blackholes: routes to targets that are gone or not part of the VPC
+//   - missing local routes and subnets without a route table
+//   - public subnets without a default route to the internet gateway, and
+//     private subnets without a default route to a NAT or transit gateway
+//   - intra and database subnets with a default route
+//   - private subnets of an airgapped VPC with a default route other than to
+//     a transit gateway, or without a route to each gateway endpoint
+//   - private subnets whose NAT gateway is in another zone, which lose
+//     internet access when that zone fails
+func ValidateRouteTables(vpc VPC, tables []RouteTable) []Problem {
+	var problems []Problem
+	report := func(check string, table RouteTable, format string, args ...interface{}) {
+		problems = append(problems, Problem{Check: check, RouteTable: table.ID, Message: fmt.Sprintf(format, args...)})
+	}
+
+	targets := knownTargets(vpc)
+	for _, table := range tables {
+		hasLocal := false
+		for _, route := range table.Routes {
+			if route.Target.Type == TargetLocal {
+				hasLocal = hasLocal || route.Destination == vpc.CIDR
+				continue
+			}
+			switch {
+			case route.State == RouteBlackhole:
+				report(CheckBlackhole, table, "route %s is a blackhole", route)
+			case !targets[route.Target.ID]:
+				report(CheckBlackhole, table, "route %s points to a target that is not part of the VPC", route)
+			}
+		}
+		if !hasLocal {
+			report(CheckLocalRoute, table, "no local route for %s", vpc.CIDR)
+		}
+
+		for _, subnetID := range table.Subnets {
+			subnet, ok := vpc.Subnet(subnetID)
+			if !ok {
+				report(CheckBlackhole, table, "associated subnet %s does not exist", subnetID)
+				continue
+			}
+			problems = append(problems, checkDefaultRoute(vpc, table, subnet)...)
+		}
+	}
+
+	for _, subnet := range vpc.Subnets {
+		if _, ok := RouteTableFor(tables, subnet.ID); !ok {
+			problems = append(problems, Problem{
+				Check:   CheckUnassociated,
+				Message: fmt.Sprintf("subnet %s has no route table and falls back to the main route table", subnet.ID),
+			})
+		}
+	}
+	return problems
+}
+
+func checkDefaultRoute(vpc VPC, table RouteTable, subnet Subnet) []Problem {
+	route, ok := table.DefaultRoute()
+	problem := func(check, format string, args ...interface{}) []Problem {
+		return []Problem{{Check: check, RouteTable: table.ID, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	switch subnet.Tier {
+	case ipam.TierPublic:
+		if !ok {
+			return problem(CheckDefaultRoute, "public subnet %s has no default route", subnet.ID)
+		}
+		if route.Target.Type != TargetInternetGateway {
+			return problem(CheckDefaultTarget, "public subnet %s routes 0.0.0.0/0 to %s, not the internet gateway", subnet.ID, route.Target)
+		}
+	case ipam.TierPrivate:
+		if vpc.Airgapped {
+			return checkAirgappedRoutes(vpc, table, subnet)
+		}
+		if !ok {
+			return problem(CheckDefaultRoute, "private subnet %s has no default route", subnet.ID)
+		}
+		switch route.Target.Type {
+		case TargetNATGateway:
+			nat, found := vpc.NATGateway(route.Target.ID)
+			if found && nat.AvailabilityZone != subnet.AvailabilityZone {
+				return problem(CheckCrossAZNAT, "private subnet %s in %s uses NAT gateway %s in %s",
+					subnet.ID, subnet.AvailabilityZone, nat.ID, nat.AvailabilityZone)
+			}
+		case TargetTransitGateway:
+		default:
+			return problem(CheckDefaultTarget, "private subnet %s routes 0.0.0.0/0 to %s, not a NAT or transit gateway", subnet.ID, route.Target)
+		}
+	case ipam.TierIntra, ipam.TierDatabase:
+		if ok {
+			return problem(CheckUnexpectedDefault, "%s subnet %s must not have a default route, has %s", subnet.Tier, subnet.ID, route)
+		}
+	}
+	return nil
+}
+
+// checkAirgappedRoutes checks that a private subnet of an airgapped VPC has
+// no way to the internet and reaches S3 and the other gateway endpoints.
+func checkAirgappedRoutes(vpc VPC, table RouteTable, subnet Subnet) []Problem {
+	var problems []Problem
+	if route, ok := table.DefaultRoute(); ok && route.Target.Type != TargetTransitGateway {
+		problems = append(problems, Problem{Check: CheckUnexpectedDefault, RouteTable: table.ID,
+			Message: fmt.Sprintf("private subnet %s of an airgapped VPC routes 0.0.0.0/0 to %s", subnet.ID, route.Target)})
+	}
+	for _, endpoint := range vpc.Endpoints {
+		if endpoint.Type != EndpointGateway {
+			continue
+		}
+		routed := slices.ContainsFunc(table.Routes, func(route Route) bool { return route.Target.ID == endpoint.ID })
+		if !routed {
+			problems = append(problems, Problem{Check: CheckEndpointRoute, RouteTable: table.ID,
+				Message: fmt.Sprintf("private subnet %s has no route to gateway endpoint %s for %s", subnet.ID, endpoint.ID, endpoint.Service)})
+		}
+	}
+	return problems
+}
+
+// knownTargets returns the IDs of the route targets that exist in vpc.
+func knownTargets(vpc VPC) map[string]bool {
+	targets := make(map[string]bool)
+	if vpc.InternetGatewayID != "" {
+		targets[vpc.InternetGatewayID] = true
+	}
+	for _, nat := range vpc.NATGateways {
+		targets[nat.ID] = true
+	}
+	for _, tgw := range vpc.TransitGateways {
+		targets[tgw.ID] = true
+	}
+	for _, endpoint := range vpc.Endpoints {
+		targets[endpoint.ID] = true
+	}
+	for _, peering := range vpc.Peerings {
+		targets[peering.ID] = true
+	}
+	return targets
+}
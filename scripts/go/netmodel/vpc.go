@@ -0,0 +1,216 @@
+// Package netmodel models the network of an Aegis VPC offline: subnets,
+// gateways, route tables, network ACLs and security groups, and answers
+// whether traffic between two addresses would be allowed.
+//
+// The generators produce what terraform/modules/vpc creates, so tests can
+// check routing and isolation guarantees without an AWS account.
+package netmodel
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"aegis-k8s-framework/ipam"
+)
+
+// VPC is the network a route table or ACL refers to.
+type VPC struct {
+	CIDR              string
+	InternetGatewayID string
+	Subnets           []Subnet
+	NATGateways       []NATGateway
+	TransitGateways   []TransitGateway
+	Endpoints         []Endpoint
+	Peerings          []Peering
+	Airgapped         bool // No way to the internet; AWS is reached through Endpoints
+}
+
+// Subnet is a subnet of the VPC.
+type Subnet struct {
+	ID               string
+	Name             string
+	CIDR             string
+	AvailabilityZone string
+	Tier             ipam.Tier
+}
+
+// NATGateway is a NAT gateway in a public subnet.
+type NATGateway struct {
+	ID               string
+	SubnetID         string
+	AvailabilityZone string
+}
+
+// TransitGateway is a transit gateway attachment and the networks routed
+// through it, such as on-premises ranges.
+type TransitGateway struct {
+	ID     string
+	Routes []string
+}
+
+// Endpoint is a VPC endpoint. Gateway endpoints (S3, DynamoDB) are route
+// targets for the prefix list of the service; interface endpoints are not.
+type Endpoint struct {
+	ID           string
+	Service      string
+	Type         string // EndpointGateway or EndpointInterface
+	PrefixListID string // Gateway endpoints only
+}
+
+// VPC endpoint types.
+const (
+	EndpointGateway   = "Gateway"
+	EndpointInterface = "Interface"
+)
+
+// Services terraform/modules/vpc creates endpoints for in an airgapped VPC:
+// S3, which holds the ECR image layers, through a gateway endpoint, and the
+// APIs nodes call through interface endpoints in every private subnet.
+var (
+	GatewayEndpointServices   = []string{"s3"}
+	InterfaceEndpointServices = []string{"ecr.api", "ecr.dkr", "sts", "ssm", "ec2", "logs", "monitoring"}
+)
+
+// EndpointServiceName returns the name of the endpoint service of an AWS
+// service in region, such as com.amazonaws.us-east-1.s3.
+func EndpointServiceName(region, service string) string {
+	return fmt.Sprintf("com.amazonaws.%s.%s", region, service)
+}
+
+// Peering is a VPC peering connection.
+type Peering struct {
+	ID       string
+	PeerCIDR string
+}
+
+// FromAllocation builds the subnets of a VPC from an ipam allocation, naming
+// them like terraform/modules/vpc: <tier>-<n> per availability zone.
+func FromAllocation(allocation *ipam.Allocation) VPC {
+	vpc := VPC{CIDR: allocation.VPC.String()}
+	for _, tier := range ipam.Tiers {
+		for i, subnet := range allocation.Tier(tier) {
+			name := fmt.Sprintf("%s-%d", tier, i+1)
+			vpc.Subnets = append(vpc.Subnets, Subnet{
+				ID:               "subnet-" + name,
+				Name:             name,
+				CIDR:             subnet.CIDR.String(),
+				AvailabilityZone: subnet.AvailabilityZone,
+				Tier:             tier,
+			})
+		}
+	}
+	return vpc
+}
+
+// ModuleVPC returns the VPC terraform/modules/vpc creates for its
+// variables: the public and private subnets in the given zones, an internet
+// gateway and a NAT gateway in every public subnet. Resource IDs are made up.
+func ModuleVPC(vpcCIDR string, availabilityZones, publicSubnets, privateSubnets []string) (VPC, error) {
+	vpc := VPC{CIDR: vpcCIDR, InternetGatewayID: "igw-main"}
+	for _, tier := range []struct {
+		tier  ipam.Tier
+		cidrs []string
+	}{{ipam.TierPublic, publicSubnets}, {ipam.TierPrivate, privateSubnets}} {
+		for i, cidr := range tier.cidrs {
+			if i >= len(availabilityZones) {
+				return VPC{}, fmt.Errorf("%s subnet %s has no availability zone", tier.tier, cidr)
+			}
+			name := fmt.Sprintf("%s-%d", tier.tier, i+1)
+			vpc.Subnets = append(vpc.Subnets, Subnet{
+				ID:               "subnet-" + name,
+				Name:             name,
+				CIDR:             cidr,
+				AvailabilityZone: availabilityZones[i],
+				Tier:             tier.tier,
+			})
+			if tier.tier == ipam.TierPublic {
+				vpc.NATGateways = append(vpc.NATGateways, NATGateway{
+					ID:               fmt.Sprintf("nat-main-%d", i+1),
+					SubnetID:         "subnet-" + name,
+					AvailabilityZone: availabilityZones[i],
+				})
+			}
+		}
+	}
+	return vpc, nil
+}
+
+// AirgappedModuleVPC returns the VPC terraform/modules/vpc creates with
+// airgapped set: only the private subnets, no internet or NAT gateways, and
+// the endpoints of GatewayEndpointServices and InterfaceEndpointServices in
+// region. Resource IDs are made up.
+func AirgappedModuleVPC(vpcCIDR, region string, availabilityZones, privateSubnets []string) (VPC, error) {
+	vpc, err := ModuleVPC(vpcCIDR, availabilityZones, nil, privateSubnets)
+	if err != nil {
+		return VPC{}, err
+	}
+	vpc.InternetGatewayID = ""
+	vpc.Airgapped = true
+	for _, service := range GatewayEndpointServices {
+		vpc.Endpoints = append(vpc.Endpoints, Endpoint{
+			ID:           "vpce-" + service,
+			Service:      EndpointServiceName(region, service),
+			Type:         EndpointGateway,
+			PrefixListID: "pl-" + service,
+		})
+	}
+	for _, service := range InterfaceEndpointServices {
+		vpc.Endpoints = append(vpc.Endpoints, Endpoint{
+			ID:      "vpce-" + strings.ReplaceAll(service, ".", "-"),
+			Service: EndpointServiceName(region, service),
+			Type:    EndpointInterface,
+		})
+	}
+	return vpc, nil
+}
+
+// Subnet returns the subnet with the given ID or name.
+func (v VPC) Subnet(idOrName string) (Subnet, bool) {
+	for _, subnet := range v.Subnets {
+		if subnet.ID == idOrName || subnet.Name == idOrName {
+			return subnet, true
+		}
+	}
+	return Subnet{}, false
+}
+
+// SubnetFor returns the subnet that contains addr.
+func (v VPC) SubnetFor(addr netip.Addr) (Subnet, bool) {
+	for _, subnet := range v.Subnets {
+		if prefix, err := netip.ParsePrefix(subnet.CIDR); err == nil && prefix.Contains(addr) {
+			return subnet, true
+		}
+	}
+	return Subnet{}, false
+}
+
+// NATGateway returns the NAT gateway with the given ID.
+func (v VPC) NATGateway(id string) (NATGateway, bool) {
+	for _, nat := range v.NATGateways {
+		if nat.ID == id {
+			return nat, true
+		}
+	}
+	return NATGateway{}, false
+}
+
+// endpoint returns the VPC endpoint with the given ID.
+func (v VPC) endpoint(id string) (Endpoint, bool) {
+	for _, endpoint := range v.Endpoints {
+		if endpoint.ID == id {
+			return endpoint, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// natGatewayIn returns the NAT gateway in zone.
+func (v VPC) natGatewayIn(zone string) (NATGateway, bool) {
+	for _, nat := range v.NATGateways {
+		if nat.AvailabilityZone == zone {
+			return nat, true
+		}
+	}
+	return NATGateway{}, false
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"aegis-k8s-framework/ipam"
+)
+
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "Plan the cluster network",
+}
+
+var networkCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the VPC CIDR and subnets against peered and on-premises networks",
+	Long: `Compare the VPC CIDR with the peeredNetworks of the config file (peered VPCs
+such as the other cluster of a cross-cluster setup, transit gateway
+attachments and on-premises ranges), and check that every public and private
+subnet lies within the VPC CIDR. Overlapping ranges cannot be routed between,
+so provisioning refuses to start while any conflict remains.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+
+		conflicts, err := networkConflicts(config)
+		if err != nil {
+			log.Fatalf("Failed to check networks: %v", err)
+		}
+		printNetworkPlan(os.Stdout, config, conflicts)
+		if len(conflicts) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	networkCmd.AddCommand(networkCheckCmd)
+	rootCmd.AddCommand(networkCmd)
+}
+
+// networkConflicts returns the peered networks that overlap the VPC, and
+// the subnets that lie outside it.
+func networkConflicts(config Config) ([]ipam.Conflict, error) {
+	conflicts, err := ipam.CheckConflicts(config.VpcCidr, config.PeeredNetworks)
+	if err != nil {
+		return nil, err
+	}
+	subnetConflicts, err := ipam.CheckSubnets(config.VpcCidr, subnetNetworks(config), config.PeeredNetworks)
+	if err != nil {
+		return nil, err
+	}
+	return append(conflicts, subnetConflicts...), nil
+}
+
+// subnetNetworks names the subnets terraform creates the way the network
+// plan lists them. Airgapped clusters have no public subnets.
+func subnetNetworks(config Config) []ipam.Network {
+	var subnets []ipam.Network
+	if !config.Airgapped {
+		for i, cidr := range config.PublicSubnets {
+			subnets = append(subnets, ipam.Network{Name: fmt.Sprintf("public-%d", i+1), CIDR: cidr})
+		}
+	}
+	for i, cidr := range config.PrivateSubnets {
+		subnets = append(subnets, ipam.Network{Name: fmt.Sprintf("private-%d", i+1), CIDR: cidr})
+	}
+	return subnets
+}
+
+// checkNetworkConflicts stops provisioning when the VPC overlaps a peered
+// network or a subnet lies outside the VPC.
+func checkNetworkConflicts(config Config) {
+	conflicts, err := networkConflicts(config)
+	if err != nil {
+		log.Fatalf("Failed to check networks: %v", err)
+	}
+	if len(conflicts) == 0 {
+		return
+	}
+	for _, conflict := range conflicts {
+		fmt.Printf("Conflict: %s\n", conflict)
+	}
+	log.Fatalf("Found %d network conflict(s) for VPC CIDR %s; change vpcCidr, the subnets or subnetLayout", len(conflicts), config.VpcCidr)
+}
+
+func printNetworkPlan(out io.Writer, config Config, conflicts []ipam.Conflict) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NETWORK\tCIDR\tSTATUS")
+	status := func(matches func(ipam.Conflict) bool) string {
+		for _, conflict := range conflicts {
+			if matches(conflict) {
+				return "CONFLICT"
+			}
+		}
+		return "ok"
+	}
+	fmt.Fprintf(w, "vpc\t%s\t%s\n", config.VpcCidr, status(func(c ipam.Conflict) bool { return c.Subnet == (ipam.Network{}) }))
+	for _, subnet := range subnetNetworks(config) {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", subnet.Name, subnet.CIDR, status(func(c ipam.Conflict) bool { return c.Subnet == subnet }))
+	}
+	for _, network := range config.PeeredNetworks {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", network.Name, network.CIDR, status(func(c ipam.Conflict) bool { return c.Network == network }))
+	}
+	w.Flush()
+
+	if len(config.PeeredNetworks) == 0 {
+		fmt.Fprintln(out, "\nNo peeredNetworks configured.")
+	}
+	fmt.Fprintf(out, "\nConflicts: %d\n", len(conflicts))
+	for _, conflict := range conflicts {
+		fmt.Fprintf(out, "  %s\n", conflict)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"aegis-k8s-framework/ipam"
+)
+
+func TestNetworkConflicts(t *testing.T) {
+	peered := []ipam.Network{
+		{Name: "cluster-b", CIDR: "10.1.0.0/16"},
+		{Name: "on-prem", CIDR: "172.16.0.0/12"},
+	}
+	tests := []struct {
+		name    string
+		config  Config
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "subnets within the VPC",
+			config: Config{
+				VpcCidr:        "10.0.0.0/16",
+				PublicSubnets:  []string{"10.0.1.0/24"},
+				PrivateSubnets: []string{"10.0.10.0/24"},
+				PeeredNetworks: peered,
+			},
+		},
+		{
+			name: "subnet outside the VPC",
+			config: Config{
+				VpcCidr:        "10.0.0.0/16",
+				PublicSubnets:  []string{"10.0.1.0/24"},
+				PrivateSubnets: []string{"10.2.10.0/24"},
+				PeeredNetworks: peered,
+			},
+			want: []string{"subnet private-1 (10.2.10.0/24) is disjoint from VPC (10.0.0.0/16)"},
+		},
+		{
+			name: "subnet overlapping a peered network",
+			config: Config{
+				VpcCidr:        "10.0.0.0/16",
+				PublicSubnets:  []string{"10.1.1.0/24"},
+				PeeredNetworks: peered,
+			},
+			want: []string{
+				"subnet public-1 (10.1.1.0/24) is disjoint from VPC (10.0.0.0/16)",
+				"subnet public-1 (10.1.1.0/24) is within cluster-b (10.1.0.0/16)",
+			},
+		},
+		{
+			name: "airgapped clusters have no public subnets",
+			config: Config{
+				VpcCidr:        "10.0.0.0/16",
+				Airgapped:      true,
+				PublicSubnets:  []string{"10.1.1.0/24"},
+				PrivateSubnets: []string{"10.0.10.0/24"},
+				PeeredNetworks: peered,
+			},
+		},
+		{
+			name: "VPC overlapping a peered network",
+			config: Config{
+				VpcCidr:        "10.1.0.0/16",
+				PrivateSubnets: []string{"10.1.10.0/24"},
+				PeeredNetworks: peered,
+			},
+			want: []string{"VPC 10.1.0.0/16 is identical to cluster-b (10.1.0.0/16)"},
+		},
+		{
+			name:    "invalid subnet",
+			config:  Config{VpcCidr: "10.0.0.0/16", PrivateSubnets: []string{"10.0.10/24"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts, err := networkConflicts(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("networkConflicts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, conflict := range conflicts {
+				got = append(got, conflict.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("networkConflicts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintNetworkPlan(t *testing.T) {
+	config := Config{
+		VpcCidr:        "10.0.0.0/16",
+		PublicSubnets:  []string{"10.0.1.0/24"},
+		PrivateSubnets: []string{"10.2.10.0/24"},
+		PeeredNetworks: []ipam.Network{{Name: "cluster-b", CIDR: "10.2.0.0/16"}},
+	}
+	conflicts, err := networkConflicts(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	printNetworkPlan(&out, config, conflicts)
+	want := map[string]string{
+		"vpc":       "ok",
+		"public-1":  "ok",
+		"private-1": "CONFLICT",
+		"cluster-b": "CONFLICT",
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		if status, ok := want[fields[0]]; ok {
+			if fields[2] != status {
+				t.Errorf("%s status = %s, want %s", fields[0], fields[2], status)
+			}
+			delete(want, fields[0])
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("network plan is missing %v:\n%s", want, out.String())
+	}
+}
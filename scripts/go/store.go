@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectStore is a flat key/value store addressed by slash-separated keys.
+// It is implemented for S3 prefixes and local directories so that backups can
+// be exercised without AWS access.
+type ObjectStore interface {
+	// List returns all keys below prefix, sorted.
+	List(prefix string) ([]string, error)
+	Get(key string) ([]byte, error)
+	Put(key string, data []byte) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+	// URL returns the store location in s3:// or file:// form.
+	URL() string
+}
+
+// openStore returns the ObjectStore for an s3://bucket/prefix or
+// file:///path location. Plain paths are treated as local directories.
+func openStore(location, region string) (ObjectStore, error) {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store location %q: %w", location, err)
+	}
+
+	switch parsed.Scheme {
+	case "s3":
+		if parsed.Host == "" {
+			return nil, fmt.Errorf("invalid store location %q: missing bucket", location)
+		}
+		sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+		if err != nil {
+			return nil, err
+		}
+		return &s3Store{
+			client: s3.New(sess),
+			bucket: parsed.Host,
+			prefix: strings.Trim(parsed.Path, "/"),
+		}, nil
+	case "file":
+		return &localStore{root: parsed.Host + parsed.Path}, nil
+	case "":
+		return &localStore{root: location}, nil
+	default:
+		return nil, fmt.Errorf("unsupported store scheme %q", parsed.Scheme)
+	}
+}
+
+type s3Store struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func (s *s3Store) key(key string) string {
+	return path.Join(s.prefix, key)
+}
+
+func (s *s3Store) List(prefix string) ([]string, error) {
+	root := s.prefix
+	if root != "" {
+		root += "/"
+	}
+
+	var keys []string
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(root + prefix),
+	}
+	err := s.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(aws.StringValue(object.Key), root))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *s3Store) Get(key string) ([]byte, error) {
+	output, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(key)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+}
+
+func (s *s3Store) Put(key string, data []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(s.key(key)),
+		Body:                 bytes.NewReader(data),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	})
+	return err
+}
+
+func (s *s3Store) Delete(key string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(key)),
+	})
+	return err
+}
+
+func (s *s3Store) URL() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
+
+type localStore struct {
+	root string
+}
+
+func (l *localStore) List(prefix string) ([]string, error) {
+	var keys []string
+
+	err := filepath.Walk(l.root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, file)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (l *localStore) Get(key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(l.root, filepath.FromSlash(key)))
+}
+
+func (l *localStore) Put(key string, data []byte) error {
+	file := filepath.Join(l.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0600)
+}
+
+func (l *localStore) Delete(key string) error {
+	err := os.Remove(filepath.Join(l.root, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (l *localStore) URL() string {
+	return "file://" + l.root
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOpenStore(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		location string
+		wantURL  string
+	}{
+		{dir, "file://" + dir},
+		{"file://" + dir, "file://" + dir},
+	}
+	for _, tt := range tests {
+		store, err := openStore(tt.location, "us-east-1")
+		if err != nil {
+			t.Fatalf("openStore(%q): %v", tt.location, err)
+		}
+		if store.URL() != tt.wantURL {
+			t.Errorf("openStore(%q).URL() = %q, want %q", tt.location, store.URL(), tt.wantURL)
+		}
+	}
+
+	for _, location := range []string{"s3:///prefix", "gs://bucket/prefix"} {
+		if _, err := openStore(location, "us-east-1"); err == nil {
+			t.Errorf("openStore(%q) succeeded, want an error", location)
+		}
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store := &localStore{root: filepath.Join(t.TempDir(), "state")}
+
+	keys, err := store.List("")
+	if err != nil || keys != nil {
+		t.Fatalf("List() on a missing root = %v, %v; want no keys", keys, err)
+	}
+
+	for _, key := range []string{"cluster/config", "cluster/instancegroup/nodes", "other"} {
+		if err := store.Put(key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err = store.List("cluster/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cluster/config", "cluster/instancegroup/nodes"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List(cluster/) = %v, want %v", keys, want)
+	}
+
+	data, err := store.Get("cluster/instancegroup/nodes")
+	if err != nil || string(data) != "cluster/instancegroup/nodes" {
+		t.Errorf("Get() = %q, %v", data, err)
+	}
+
+	if err := store.Delete("other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("other"); err != nil {
+		t.Errorf("deleting a missing key: %v", err)
+	}
+	if _, err := store.Get("other"); err == nil {
+		t.Error("Get() of a deleted key succeeded")
+	}
+}
+
+// newKopsState returns a local kops state store with a cluster spec, two
+// instance groups and two etcd-manager backups of each etcd cluster.
+func newKopsState(t *testing.T) ObjectStore {
+	t.Helper()
+	kopsState := &localStore{root: filepath.Join(t.TempDir(), "kops-staging")}
+	objects := map[string]string{
+		"staging.cluster.aegis.local/config":                          "cluster v1",
+		"staging.cluster.aegis.local/instancegroup/master-us-east-1a": "master v1",
+		"staging.cluster.aegis.local/instancegroup/nodes":             "nodes v1",
+	}
+	for _, cluster := range etcdClusters {
+		for _, name := range []string{"2026-10-18T10:00:00Z-000001", "2026-10-18T10:15:00Z-000002"} {
+			objects[etcdBackupPrefix+cluster+"/"+name+"/etcd.backup.gz"] = cluster + " " + name
+			objects[etcdBackupPrefix+cluster+"/"+name+"/_etcd_backup.meta"] = "{}"
+		}
+		objects[etcdBackupPrefix+cluster+"/control/etcd-cluster-spec"] = "{}"
+	}
+	for key, data := range objects {
+		if err := kopsState.Put(key, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kopsState
+}
+
+func createTestBackup(t *testing.T, backups, kopsState ObjectStore) *BackupManifest {
+	t.Helper()
+	recordTerraform := backupRecordTerraform
+	backupRecordTerraform = false
+	t.Cleanup(func() { backupRecordTerraform = recordTerraform })
+
+	config := Config{Environment: "staging", ClusterName: "staging.cluster.aegis.local"}
+	manifest, err := createBackup(config, backups, kopsState)
+	if err != nil {
+		t.Fatalf("createBackup: %v", err)
+	}
+	return manifest
+}
+
+func setPrune(t *testing.T, prune bool) {
+	t.Helper()
+	previous := backupPrune
+	backupPrune = prune
+	t.Cleanup(func() { backupPrune = previous })
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	setPrune(t, false)
+	backups := &localStore{root: filepath.Join(t.TempDir(), "backups")}
+	kopsState := newKopsState(t)
+
+	manifest := createTestBackup(t, backups, kopsState)
+	wantEtcd := map[string]string{"main": "2026-10-18T10:15:00Z-000002", "events": "2026-10-18T10:15:00Z-000002"}
+	if !reflect.DeepEqual(manifest.EtcdBackups, wantEtcd) {
+		t.Errorf("EtcdBackups = %v, want %v", manifest.EtcdBackups, wantEtcd)
+	}
+	// Three kops objects and the two files of the latest backup per etcd cluster
+	if len(manifest.Objects) != 7 {
+		t.Errorf("backup has %d objects, want 7: %v", len(manifest.Objects), manifest.Objects)
+	}
+
+	listed, err := listBackups(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ID != manifest.ID {
+		t.Fatalf("listBackups() = %v, want backup %s", listed, manifest.ID)
+	}
+	read, err := readBackupManifest(backups, manifest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBackup(backups, read); err != nil {
+		t.Fatalf("verifyBackup: %v", err)
+	}
+
+	// Change the cluster after the backup and restore it
+	if err := kopsState.Put("staging.cluster.aegis.local/instancegroup/nodes", []byte("nodes v2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := kopsState.Put("staging.cluster.aegis.local/instancegroup/spot", []byte("spot v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreBackup(backups, kopsState, read); err != nil {
+		t.Fatalf("restoreBackup: %v", err)
+	}
+
+	data, err := kopsState.Get("staging.cluster.aegis.local/instancegroup/nodes")
+	if err != nil || string(data) != "nodes v1" {
+		t.Errorf("restored nodes = %q, %v; want nodes v1", data, err)
+	}
+	// Without --prune objects created after the backup are kept
+	if _, err := kopsState.Get("staging.cluster.aegis.local/instancegroup/spot"); err != nil {
+		t.Errorf("spot instance group was removed without --prune: %v", err)
+	}
+}
+
+func TestVerifyBackupDetectsCorruption(t *testing.T) {
+	backups := &localStore{root: filepath.Join(t.TempDir(), "backups")}
+	manifest := createTestBackup(t, backups, newKopsState(t))
+
+	key := filepath.ToSlash(filepath.Join(manifest.ID, "kops", "staging.cluster.aegis.local", "config"))
+	if err := backups.Put(key, []byte("tampered")); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBackup(backups, manifest); err == nil {
+		t.Error("verifyBackup accepted a modified object")
+	}
+}
+
+func TestRestoreBackupPrune(t *testing.T) {
+	setPrune(t, true)
+	backups := &localStore{root: filepath.Join(t.TempDir(), "backups")}
+	kopsState := newKopsState(t)
+	manifest := createTestBackup(t, backups, kopsState)
+
+	newer := "staging.cluster.aegis.local/instancegroup/spot"
+	newerEtcd := etcdBackupPrefix + "main/2026-10-18T10:30:00Z-000003/etcd.backup.gz"
+	for _, key := range []string{newer, newerEtcd} {
+		if err := kopsState.Put(key, []byte("after the backup")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stale, err := staleKopsKeys(kopsState, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{newer}; !reflect.DeepEqual(stale, want) {
+		t.Errorf("staleKopsKeys() = %v, want %v", stale, want)
+	}
+
+	if err := restoreBackup(backups, kopsState, manifest); err != nil {
+		t.Fatalf("restoreBackup: %v", err)
+	}
+	if _, err := kopsState.Get(newer); err == nil {
+		t.Errorf("%s was not pruned", newer)
+	}
+	// etcd-manager backups are never pruned
+	if _, err := kopsState.Get(newerEtcd); err != nil {
+		t.Errorf("%s was pruned: %v", newerEtcd, err)
+	}
+	if _, err := kopsState.Get("staging.cluster.aegis.local/instancegroup/nodes"); err != nil {
+		t.Errorf("instance group in the backup is missing after restore: %v", err)
+	}
+}
+
+func TestCreateBackupCollision(t *testing.T) {
+	taken := time.Date(2026, 10, 18, 12, 0, 0, 250e6, time.UTC)
+	backupTime = func() time.Time { return taken }
+	t.Cleanup(func() { backupTime = time.Now })
+
+	backups := &localStore{root: filepath.Join(t.TempDir(), "backups")}
+	kopsState := newKopsState(t)
+	manifest := createTestBackup(t, backups, kopsState)
+	if want := "staging-20261018-120000.250"; manifest.ID != want {
+		t.Errorf("backup ID = %s, want %s", manifest.ID, want)
+	}
+
+	// A second backup started at the same time must not overwrite the first
+	config := Config{Environment: "staging", ClusterName: "staging.cluster.aegis.local"}
+	if _, err := createBackup(config, backups, kopsState); err == nil {
+		t.Error("created a second backup with the same ID")
+	}
+}
+
+func TestCheckBackupTarget(t *testing.T) {
+	kopsState := &localStore{root: filepath.Join(t.TempDir(), "kops-staging")}
+	manifest := &BackupManifest{ID: "staging-1", Environment: "staging", KopsStateStore: kopsState.URL()}
+
+	if err := checkBackupTarget(Config{Environment: "staging"}, kopsState, manifest); err != nil {
+		t.Errorf("matching target: %v", err)
+	}
+	if err := checkBackupTarget(Config{Environment: "production"}, kopsState, manifest); err == nil {
+		t.Error("restored a staging backup into production")
+	}
+	other := &localStore{root: filepath.Join(t.TempDir(), "kops-staging")}
+	if err := checkBackupTarget(Config{Environment: "staging"}, other, manifest); err == nil {
+		t.Error("restored a backup into another kops state store")
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// testHistoryPath is the results store written by the test runner in tests/.
+const testHistoryPath = "../../tests/reports/history.jsonl"
+
+// testRun and testRunResult mirror the lines of the test history store.
+type testRun struct {
+	RunID       string          `json:"runId"`
+	Environment string          `json:"environment"`
+	GitCommit   string          `json:"gitCommit"`
+	StartTime   time.Time       `json:"startTime"`
+	EndTime     time.Time       `json:"endTime"`
+	Results     []testRunResult `json:"results"`
+}
+
+type testRunResult struct {
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Priority int     `json:"priority"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"durationSeconds"`
+}
+
+// suiteTrend summarises the history of one suite.
+type suiteTrend struct {
+	Name       string
+	Runs       int
+	Passed     int
+	History    string // one character per run, oldest first: . pass, F fail, S skip, - not run
+	Flips      int    // pass/fail transitions
+	Latest     float64
+	Median     float64 // median duration of the earlier runs
+	Regression bool
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Analyse test results",
+}
+
+var reportTrendsCmd = &cobra.Command{
+	Use:   "trends",
+	Short: "Show pass rates, flaky suites and duration regressions over recent test runs",
+	Long: `Read the history store written by the test runner (tests/reports/history.jsonl)
+and show, for the most recent runs:
+  - the pass rate of every run and every suite
+  - flaky suites that alternate between passing and failing
+  - suites whose latest duration regressed against their median`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runs, err := loadTestHistory(trendsHistoryPath)
+		if err != nil {
+			log.Fatalf("Failed to read test history: %v", err)
+		}
+		runs = filterTestRuns(runs, trendsEnvironment, trendsLast)
+		if len(runs) == 0 {
+			fmt.Println("No test runs recorded.")
+			return
+		}
+
+		trends := suiteTrends(runs, trendsRegressionFactor)
+		printRunTrends(os.Stdout, runs)
+		printSuiteTrends(os.Stdout, trends, trendsFlakyFlips)
+	},
+}
+
+var (
+	trendsHistoryPath      string
+	trendsEnvironment      string
+	trendsLast             int
+	trendsFlakyFlips       int
+	trendsRegressionFactor float64
+)
+
+func init() {
+	reportTrendsCmd.Flags().StringVar(&trendsHistoryPath, "history", testHistoryPath, "Test history store to read")
+	reportTrendsCmd.Flags().StringVar(&trendsEnvironment, "env", "", "Only include runs from this environment")
+	reportTrendsCmd.Flags().IntVar(&trendsLast, "last", 20, "Number of most recent runs to analyse")
+	reportTrendsCmd.Flags().IntVar(&trendsFlakyFlips, "flaky-flips", 2, "Pass/fail transitions after which a suite is reported as flaky")
+	reportTrendsCmd.Flags().Float64Var(&trendsRegressionFactor, "regression-factor", 1.5, "Report a suite when its latest duration exceeds its median by this factor")
+
+	reportCmd.AddCommand(reportTrendsCmd)
+	rootCmd.AddCommand(reportCmd)
+}
+
+func loadTestHistory(path string) ([]testRun, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var runs []testRun
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var run testRun
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartTime.Before(runs[j].StartTime)
+	})
+	return runs, nil
+}
+
+// filterTestRuns keeps the last runs of the given environment (all
+// environments when empty).
+func filterTestRuns(runs []testRun, environment string, last int) []testRun {
+	var filtered []testRun
+	for _, run := range runs {
+		if environment == "" || run.Environment == environment {
+			filtered = append(filtered, run)
+		}
+	}
+	if last > 0 && len(filtered) > last {
+		filtered = filtered[len(filtered)-last:]
+	}
+	return filtered
+}
+
+func suiteTrends(runs []testRun, regressionFactor float64) []suiteTrend {
+	var names []string
+	seen := make(map[string]bool)
+	for _, run := range runs {
+		for _, result := range run.Results {
+			if !seen[result.Name] {
+				seen[result.Name] = true
+				names = append(names, result.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	trends := make([]suiteTrend, 0, len(names))
+	for _, name := range names {
+		trend := suiteTrend{Name: name}
+		var history strings.Builder
+		var durations []float64
+		lastStatus := ""
+
+		for _, run := range runs {
+			result, ok := findTestRunResult(run, name)
+			if !ok {
+				history.WriteByte('-')
+				continue
+			}
+
+			trend.Runs++
+			switch result.Status {
+			case "PASS":
+				trend.Passed++
+				history.WriteByte('.')
+			case "FAIL":
+				history.WriteByte('F')
+			default:
+				history.WriteByte('S')
+			}
+
+			if result.Status == "PASS" || result.Status == "FAIL" {
+				if lastStatus != "" && lastStatus != result.Status {
+					trend.Flips++
+				}
+				lastStatus = result.Status
+				durations = append(durations, result.Duration)
+			}
+		}
+		trend.History = history.String()
+
+		if len(durations) > 0 {
+			trend.Latest = durations[len(durations)-1]
+		}
+		// Need a few earlier runs before a median is meaningful.
+		if len(durations) >= 4 {
+			trend.Median = median(durations[:len(durations)-1])
+			trend.Regression = trend.Median > 0 && trend.Latest > trend.Median*regressionFactor
+		}
+		trends = append(trends, trend)
+	}
+	return trends
+}
+
+func findTestRunResult(run testRun, name string) (testRunResult, bool) {
+	for _, result := range run.Results {
+		if result.Name == name {
+			return result, true
+		}
+	}
+	return testRunResult{}, false
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+func passRate(passed, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(passed)/float64(total)*100)
+}
+
+func printRunTrends(out io.Writer, runs []testRun) {
+	fmt.Fprintf(out, "Test Runs (oldest first)\n")
+	fmt.Fprintln(out, strings.Repeat("=", 50))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tENVIRONMENT\tCOMMIT\tPASSED\tPASS RATE")
+	for _, run := range runs {
+		passed := 0
+		for _, result := range run.Results {
+			if result.Status == "PASS" {
+				passed++
+			}
+		}
+		commit := run.GitCommit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\n", run.RunID, run.Environment, commit,
+			passed, len(run.Results), passRate(passed, len(run.Results)))
+	}
+	w.Flush()
+}
+
+func printSuiteTrends(out io.Writer, trends []suiteTrend, flakyFlips int) {
+	fmt.Fprintf(out, "\nSuites (history oldest first: . pass, F fail, S skip, - not run)\n")
+	fmt.Fprintln(out, strings.Repeat("=", 50))
+
+	var flaky, regressed []string
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SUITE\tRUNS\tPASS RATE\tHISTORY\tLATEST\tMEDIAN\tNOTES")
+	for _, trend := range trends {
+		var notes []string
+		if trend.Flips >= flakyFlips {
+			notes = append(notes, "flaky")
+			flaky = append(flaky, trend.Name)
+		}
+		medianDuration := "-"
+		if trend.Median > 0 {
+			medianDuration = fmt.Sprintf("%.2fs", trend.Median)
+		}
+		if trend.Regression {
+			notes = append(notes, fmt.Sprintf("slower +%.0f%%", (trend.Latest/trend.Median-1)*100))
+			regressed = append(regressed, trend.Name)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%.2fs\t%s\t%s\n", trend.Name, trend.Runs,
+			passRate(trend.Passed, trend.Runs), trend.History, trend.Latest, medianDuration,
+			strings.Join(notes, ", "))
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\nFlaky suites: %d", len(flaky))
+	if len(flaky) > 0 {
+		fmt.Fprintf(out, " (%s)", strings.Join(flaky, ", "))
+	}
+	fmt.Fprintf(out, "\nDuration regressions: %d", len(regressed))
+	if len(regressed) > 0 {
+		fmt.Fprintf(out, " (%s)", strings.Join(regressed, ", "))
+	}
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, set at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=...".
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version and build information",
+	Run: func(cmd *cobra.Command, args []string) {
+		revision, buildTime := commit, buildDate
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				switch {
+				case setting.Key == "vcs.revision" && revision == "":
+					revision = setting.Value
+				case setting.Key == "vcs.time" && buildTime == "":
+					buildTime = setting.Value
+				}
+			}
+		}
+
+		fmt.Printf("aegis %s\n", version)
+		fmt.Printf("Commit: %s\n", valueOrDefault(revision, "unknown"))
+		fmt.Printf("Built: %s\n", valueOrDefault(buildTime, "unknown"))
+		fmt.Printf("Go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	},
+}
+
+func init() {
+	rootCmd.Version = version
+	rootCmd.AddCommand(versionCmd)
+}
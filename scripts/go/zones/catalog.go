@@ -0,0 +1,100 @@
+package zones
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yaml
+var bundledCatalog []byte
+
+// Catalog is an offline Provider backed by a YAML zone catalog.
+type Catalog struct {
+	Updated string
+	regions map[string][]Zone
+	optedIn map[string]bool
+}
+
+type catalogFile struct {
+	Updated string                        `yaml:"updated"`
+	Regions map[string][]catalogZoneEntry `yaml:"regions"`
+}
+
+type catalogZoneEntry struct {
+	Name     string `yaml:"name"`
+	ID       string `yaml:"id"`
+	Type     string `yaml:"type"`
+	Group    string `yaml:"group"`
+	ParentID string `yaml:"parent"`
+}
+
+// LoadCatalog reads the catalog at path, or the catalog bundled with the CLI
+// when path is empty. Local zones are reported as not opted in unless their
+// group is listed in optedInGroups.
+func LoadCatalog(path string, optedInGroups []string) (*Catalog, error) {
+	data := bundledCatalog
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var file catalogFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid zone catalog: %w", err)
+	}
+
+	catalog := &Catalog{
+		Updated: file.Updated,
+		regions: make(map[string][]Zone, len(file.Regions)),
+		optedIn: make(map[string]bool, len(optedInGroups)),
+	}
+	for _, group := range optedInGroups {
+		catalog.optedIn[group] = true
+	}
+	for region, entries := range file.Regions {
+		for _, entry := range entries {
+			if entry.Name == "" || entry.ID == "" {
+				return nil, fmt.Errorf("invalid zone catalog: zone in %s without name or id", region)
+			}
+			zone := Zone{
+				Name:     entry.Name,
+				ID:       entry.ID,
+				Region:   region,
+				Type:     entry.Type,
+				Group:    entry.Group,
+				ParentID: entry.ParentID,
+			}
+			if zone.Type == "" {
+				zone.Type = TypeAvailabilityZone
+			}
+			if zone.Group == "" {
+				zone.Group = region
+			}
+			zone.OptInStatus = OptInNotRequired
+			if zone.Type == TypeLocalZone {
+				zone.OptInStatus = NotOptedIn
+				if catalog.optedIn[zone.Group] {
+					zone.OptInStatus = OptedIn
+				}
+			}
+			catalog.regions[region] = append(catalog.regions[region], zone)
+		}
+		sortZones(catalog.regions[region])
+	}
+	return catalog, nil
+}
+
+// Zones implements Provider.
+func (c *Catalog) Zones(region string) ([]Zone, error) {
+	zones, ok := c.regions[region]
+	if !ok {
+		return nil, fmt.Errorf("%w %q in the zone catalog", ErrUnknownRegion, region)
+	}
+	return append([]Zone(nil), zones...), nil
+}
@@ -0,0 +1,46 @@
+package zones
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// EC2 is a Provider that asks the EC2 API, so it reports the zone names and
+// opt-in status of the calling account.
+type EC2 struct {
+	Session *session.Session
+}
+
+// Zones implements Provider.
+func (p EC2) Zones(region string) ([]Zone, error) {
+	client := ec2.New(p.Session, aws.NewConfig().WithRegion(region))
+	output, err := client.DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{
+		AllAvailabilityZones: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing zones of %s: %w", region, err)
+	}
+
+	var zones []Zone
+	for _, az := range output.AvailabilityZones {
+		// Wavelength zones cannot host cluster subnets.
+		zoneType := aws.StringValue(az.ZoneType)
+		if zoneType != TypeAvailabilityZone && zoneType != TypeLocalZone {
+			continue
+		}
+		zones = append(zones, Zone{
+			Name:        aws.StringValue(az.ZoneName),
+			ID:          aws.StringValue(az.ZoneId),
+			Region:      aws.StringValue(az.RegionName),
+			Type:        zoneType,
+			Group:       aws.StringValue(az.GroupName),
+			ParentID:    aws.StringValue(az.ParentZoneId),
+			OptInStatus: aws.StringValue(az.OptInStatus),
+		})
+	}
+	sortZones(zones)
+	return zones, nil
+}
@@ -0,0 +1,42 @@
+package zones
+
+import "fmt"
+
+// Fake is a Provider with fixed zones for tests.
+type Fake struct {
+	Regions map[string][]Zone
+	Err     error    // Returned by every call when set
+	Calls   []string // Regions looked up, in order
+}
+
+// Zones implements Provider.
+func (f *Fake) Zones(region string) ([]Zone, error) {
+	f.Calls = append(f.Calls, region)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	zones, ok := f.Regions[region]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRegion, region)
+	}
+	zones = append([]Zone(nil), zones...)
+	sortZones(zones)
+	return zones, nil
+}
+
+// FakeRegion returns availability zones named region+suffix with made-up
+// zone IDs, for building Fake providers.
+func FakeRegion(region string, suffixes ...string) []Zone {
+	zones := make([]Zone, 0, len(suffixes))
+	for i, suffix := range suffixes {
+		zones = append(zones, Zone{
+			Name:        region + suffix,
+			ID:          fmt.Sprintf("%s-az%d", region, i+1),
+			Region:      region,
+			Type:        TypeAvailabilityZone,
+			Group:       region,
+			OptInStatus: OptInNotRequired,
+		})
+	}
+	return zones
+}
@@ -0,0 +1,70 @@
+package zones
+
+import "fmt"
+
+// Strategy decides how the members of a group are spread across zones.
+type Strategy string
+
+const (
+	// Spread places members round-robin, so no zone holds more than one
+	// member more than any other.
+	Spread Strategy = "spread"
+	// Pack places every member in the first zone, trading zone failure
+	// tolerance for no cross-zone traffic.
+	Pack Strategy = "pack"
+)
+
+// ParseStrategy returns the Strategy named s.
+func ParseStrategy(s string) (Strategy, error) {
+	switch strategy := Strategy(s); strategy {
+	case Spread, Pack:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown placement strategy %q (available: %s, %s)", s, Spread, Pack)
+	}
+}
+
+// Place returns the zone of each of count members, in order. Zones that are
+// not available are skipped.
+func Place(zones []Zone, count int, strategy Strategy) ([]Zone, error) {
+	var available []Zone
+	for _, zone := range zones {
+		if zone.Available() {
+			available = append(available, zone)
+		}
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("cannot place %d members", count)
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("no available zones to place members in")
+	}
+
+	placement := make([]Zone, count)
+	for i := range placement {
+		switch strategy {
+		case Spread:
+			placement[i] = available[i%len(available)]
+		case Pack:
+			placement[i] = available[0]
+		default:
+			return nil, fmt.Errorf("unknown placement strategy %q", strategy)
+		}
+	}
+	return placement, nil
+}
+
+// PlaceMasters returns the zones of count masters, one per availability
+// zone. etcd needs an odd number of members to keep quorum, and members in
+// distinct zones so that losing a zone loses at most one of them.
+func PlaceMasters(zones []Zone, count int) ([]Zone, error) {
+	if count < 1 || count%2 == 0 {
+		return nil, fmt.Errorf("%d masters: etcd needs an odd number of members", count)
+	}
+	azs := AvailabilityZones(zones)
+	if len(azs) < count {
+		return nil, fmt.Errorf("%d masters need %d availability zones, only %d available (%v)",
+			count, count, len(azs), Names(azs))
+	}
+	return Place(azs[:count], count, Spread)
+}
@@ -0,0 +1,119 @@
+// Package zones describes the availability zones of AWS regions and places
+// masters and node groups across them.
+//
+// Zones come from a Provider: the offline Catalog bundled with the CLI, the
+// EC2 API, or a Fake in tests.
+package zones
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Zone types, as reported by EC2.
+const (
+	TypeAvailabilityZone = "availability-zone"
+	TypeLocalZone        = "local-zone"
+)
+
+// Opt-in states, as reported by EC2.
+const (
+	OptInNotRequired = "opt-in-not-required"
+	OptedIn          = "opted-in"
+	NotOptedIn       = "not-opted-in"
+)
+
+// ErrUnknownRegion is returned by providers for regions they do not know.
+var ErrUnknownRegion = errors.New("unknown region")
+
+// Zone is an availability zone or local zone.
+type Zone struct {
+	Name        string // Account-specific name, such as us-east-1a
+	ID          string // Name-independent ID, such as use1-az1
+	Region      string
+	Type        string // TypeAvailabilityZone or TypeLocalZone
+	Group       string // Opt-in group of a local zone; the region for availability zones
+	ParentID    string // Availability zone a local zone is attached to
+	OptInStatus string
+}
+
+// Available reports whether resources can be launched in the zone.
+func (z Zone) Available() bool {
+	return z.OptInStatus != NotOptedIn
+}
+
+// Provider looks up the zones of a region.
+type Provider interface {
+	// Zones returns every zone of region, including local zones that are
+	// not opted in, ordered by name.
+	Zones(region string) ([]Zone, error)
+}
+
+// AvailabilityZones returns the available availability zones, leaving out
+// local zones; these are the zones masters and subnets are placed in.
+func AvailabilityZones(zones []Zone) []Zone {
+	var result []Zone
+	for _, zone := range zones {
+		if zone.Type == TypeAvailabilityZone && zone.Available() {
+			result = append(result, zone)
+		}
+	}
+	return result
+}
+
+// LocalZones returns the local zones, opted in or not.
+func LocalZones(zones []Zone) []Zone {
+	var result []Zone
+	for _, zone := range zones {
+		if zone.Type == TypeLocalZone {
+			result = append(result, zone)
+		}
+	}
+	return result
+}
+
+// Names returns the names of zones.
+func Names(zones []Zone) []string {
+	names := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		names = append(names, zone.Name)
+	}
+	return names
+}
+
+// Require checks that every named zone exists in region and is an available
+// availability zone. It validates templates that hard-code zone names, such
+// as the {{REGION}}a/b/c subnets of the kops cluster template.
+func Require(provider Provider, region string, names []string) error {
+	zones, err := provider.Zones(region)
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]Zone, len(zones))
+	for _, zone := range zones {
+		byName[zone.Name] = zone
+	}
+
+	var errs []error
+	for _, name := range names {
+		zone, ok := byName[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("zone %s does not exist in %s (available: %v)",
+				name, region, Names(AvailabilityZones(zones))))
+		case zone.Type != TypeAvailabilityZone:
+			errs = append(errs, fmt.Errorf("zone %s is a %s, not an availability zone", name, zone.Type))
+		case !zone.Available():
+			errs = append(errs, fmt.Errorf("zone %s is not opted in", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func sortZones(zones []Zone) {
+	sort.Slice(zones, func(i, j int) bool {
+		return zones[i].Name < zones[j].Name
+	})
+}
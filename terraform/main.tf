@@ -37,6 +37,7 @@ module "vpc" {
   public_subnets     = var.public_subnets
   private_subnets    = var.private_subnets
   environment        = var.environment
+  airgapped          = var.airgapped
 }
 
 # IAM Module
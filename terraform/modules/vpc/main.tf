@@ -7,6 +7,9 @@ locals {
     ManagedBy     = "terraform"
     Purpose       = "kubernetes-cluster"
   }
+
+  # Airgapped VPCs have no public subnets and no way to the internet
+  public_subnets = var.airgapped ? [] : var.public_subnets
 }
 
 resource "aws_vpc" "main" {
@@ -23,9 +26,9 @@ resource "aws_vpc" "main" {
 }
 
 resource "aws_subnet" "public" {
-  count             = length(var.public_subnets)
+  count             = length(local.public_subnets)
   vpc_id            = aws_vpc.main.id
-  cidr_block        = var.public_subnets[count.index]
+  cidr_block        = local.public_subnets[count.index]
   availability_zone = var.availability_zones[count.index]
 
   tags = merge(
@@ -57,6 +60,7 @@ resource "aws_subnet" "private" {
 }
 
 resource "aws_internet_gateway" "main" {
+  count  = var.airgapped ? 0 : 1
   vpc_id = aws_vpc.main.id
 
   tags = merge(
@@ -70,7 +74,7 @@ resource "aws_internet_gateway" "main" {
 }
 
 resource "aws_nat_gateway" "main" {
-  count         = length(var.public_subnets)
+  count         = length(local.public_subnets)
   allocation_id = aws_eip.nat[count.index].id
   subnet_id     = aws_subnet.public[count.index].id
 
@@ -85,7 +89,7 @@ resource "aws_nat_gateway" "main" {
 }
 
 resource "aws_eip" "nat" {
-  count  = length(var.public_subnets)
+  count  = length(local.public_subnets)
   domain = "vpc"
 
   tags = merge(
@@ -97,11 +101,12 @@ resource "aws_eip" "nat" {
 }
 
 resource "aws_route_table" "public" {
+  count  = var.airgapped ? 0 : 1
   vpc_id = aws_vpc.main.id
 
   route {
     cidr_block = "0.0.0.0/0"
-    gateway_id = aws_internet_gateway.main.id
+    gateway_id = aws_internet_gateway.main[0].id
   }
 
   tags = merge(
@@ -115,9 +120,9 @@ resource "aws_route_table" "public" {
 }
 
 resource "aws_route_table_association" "public" {
-  count          = length(var.public_subnets)
+  count          = length(local.public_subnets)
   subnet_id      = aws_subnet.public[count.index].id
-  route_table_id = aws_route_table.public.id
+  route_table_id = aws_route_table.public[0].id
 
   depends_on = [aws_subnet.public, aws_route_table.public]
 }
@@ -126,17 +131,21 @@ resource "aws_route_table" "private" {
   count  = length(var.private_subnets)
   vpc_id = aws_vpc.main.id
 
-  route {
-    cidr_block     = "0.0.0.0/0"
-    nat_gateway_id = aws_nat_gateway.main[count.index].id
-  }
-
   tags = merge(
     local.common_tags,
     {
       Name = "${local.name_prefix}-private-rt-${count.index + 1}"
     }
   )
+}
+
+# Private subnets reach the internet through the NAT gateway in their zone;
+# airgapped ones have no default route and reach AWS through VPC endpoints
+resource "aws_route" "private_nat" {
+  count                  = var.airgapped ? 0 : length(var.private_subnets)
+  route_table_id         = aws_route_table.private[count.index].id
+  destination_cidr_block = "0.0.0.0/0"
+  nat_gateway_id         = aws_nat_gateway.main[count.index].id
 
   depends_on = [aws_nat_gateway.main]
 }
@@ -147,4 +156,167 @@ resource "aws_route_table_association" "private" {
   route_table_id = aws_route_table.private[count.index].id
 
   depends_on = [aws_subnet.private, aws_route_table.private]
-}
\ No newline at end of file
+}
+# Network ACLs per subnet tier. Keep in sync with GenerateNACLRules in
+# scripts/go/netmodel, which the offline tests evaluate. ACLs are stateless,
+# so return traffic is allowed on the ephemeral ports, and every ACL ends
+# with an explicit deny-all rule.
+locals {
+  ephemeral_ports = { from = 1024, to = 65535 }
+  deny_all_rule   = { rule_no = 32000, action = "deny", protocol = "-1", cidr_block = "0.0.0.0/0", from_port = 0, to_port = 0 }
+
+  public_nacl_ingress = [
+    { rule_no = 100, action = "allow", protocol = "-1", cidr_block = var.vpc_cidr, from_port = 0, to_port = 0 },
+    { rule_no = 200, action = "allow", protocol = "tcp", cidr_block = "0.0.0.0/0", from_port = 80, to_port = 80 },
+    { rule_no = 300, action = "allow", protocol = "tcp", cidr_block = "0.0.0.0/0", from_port = 443, to_port = 443 },
+    { rule_no = 400, action = "allow", protocol = "tcp", cidr_block = "0.0.0.0/0", from_port = local.ephemeral_ports.from, to_port = local.ephemeral_ports.to },
+    local.deny_all_rule,
+  ]
+  public_nacl_egress = local.public_nacl_ingress
+
+  private_nacl_ingress = [
+    { rule_no = 100, action = "allow", protocol = "-1", cidr_block = var.vpc_cidr, from_port = 0, to_port = 0 },
+    { rule_no = 200, action = "allow", protocol = "tcp", cidr_block = "0.0.0.0/0", from_port = local.ephemeral_ports.from, to_port = local.ephemeral_ports.to },
+    local.deny_all_rule,
+  ]
+  private_nacl_egress = [
+    { rule_no = 100, action = "allow", protocol = "-1", cidr_block = var.vpc_cidr, from_port = 0, to_port = 0 },
+    { rule_no = 200, action = "allow", protocol = "tcp", cidr_block = "0.0.0.0/0", from_port = 80, to_port = 80 },
+    { rule_no = 300, action = "allow", protocol = "tcp", cidr_block = "0.0.0.0/0", from_port = 443, to_port = 443 },
+    local.deny_all_rule,
+  ]
+}
+
+resource "aws_network_acl" "public" {
+  count      = var.airgapped ? 0 : 1
+  vpc_id     = aws_vpc.main.id
+  subnet_ids = aws_subnet.public[*].id
+
+  dynamic "ingress" {
+    for_each = local.public_nacl_ingress
+    content {
+      rule_no    = ingress.value.rule_no
+      action     = ingress.value.action
+      protocol   = ingress.value.protocol
+      cidr_block = ingress.value.cidr_block
+      from_port  = ingress.value.from_port
+      to_port    = ingress.value.to_port
+    }
+  }
+
+  dynamic "egress" {
+    for_each = local.public_nacl_egress
+    content {
+      rule_no    = egress.value.rule_no
+      action     = egress.value.action
+      protocol   = egress.value.protocol
+      cidr_block = egress.value.cidr_block
+      from_port  = egress.value.from_port
+      to_port    = egress.value.to_port
+    }
+  }
+
+  tags = merge(
+    local.common_tags,
+    {
+      Name = "${local.name_prefix}-public-nacl"
+    }
+  )
+}
+
+resource "aws_network_acl" "private" {
+  vpc_id     = aws_vpc.main.id
+  subnet_ids = aws_subnet.private[*].id
+
+  dynamic "ingress" {
+    for_each = local.private_nacl_ingress
+    content {
+      rule_no    = ingress.value.rule_no
+      action     = ingress.value.action
+      protocol   = ingress.value.protocol
+      cidr_block = ingress.value.cidr_block
+      from_port  = ingress.value.from_port
+      to_port    = ingress.value.to_port
+    }
+  }
+
+  dynamic "egress" {
+    for_each = local.private_nacl_egress
+    content {
+      rule_no    = egress.value.rule_no
+      action     = egress.value.action
+      protocol   = egress.value.protocol
+      cidr_block = egress.value.cidr_block
+      from_port  = egress.value.from_port
+      to_port    = egress.value.to_port
+    }
+  }
+
+  tags = merge(
+    local.common_tags,
+    {
+      Name = "${local.name_prefix}-private-nacl"
+    }
+  )
+}
+
+# VPC endpoints of airgapped VPCs: nodes pull images from ECR (whose layers
+# are stored in S3), assume roles, register with SSM and ship logs and
+# metrics without a NAT gateway. The S3 gateway endpoint is free; interface
+# endpoints are billed per zone. Keep the services in sync with
+# InterfaceEndpointServices in scripts/go/netmodel.
+data "aws_region" "current" {}
+
+resource "aws_vpc_endpoint" "s3" {
+  count             = var.airgapped ? 1 : 0
+  vpc_id            = aws_vpc.main.id
+  service_name      = "com.amazonaws.${data.aws_region.current.region}.s3"
+  vpc_endpoint_type = "Gateway"
+  route_table_ids   = aws_route_table.private[*].id
+
+  tags = merge(
+    local.common_tags,
+    {
+      Name = "${local.name_prefix}-s3-endpoint"
+    }
+  )
+}
+
+resource "aws_security_group" "endpoints" {
+  count       = var.airgapped ? 1 : 0
+  name        = "${local.name_prefix}-endpoints"
+  description = "HTTPS from the VPC to the interface endpoints"
+  vpc_id      = aws_vpc.main.id
+
+  ingress {
+    description = "HTTPS from the VPC"
+    from_port   = 443
+    to_port     = 443
+    protocol    = "tcp"
+    cidr_blocks = [var.vpc_cidr]
+  }
+
+  tags = merge(
+    local.common_tags,
+    {
+      Name = "${local.name_prefix}-endpoints-sg"
+    }
+  )
+}
+
+resource "aws_vpc_endpoint" "interface" {
+  for_each            = var.airgapped ? toset(var.interface_endpoint_services) : toset([])
+  vpc_id              = aws_vpc.main.id
+  service_name        = "com.amazonaws.${data.aws_region.current.region}.${each.value}"
+  vpc_endpoint_type   = "Interface"
+  subnet_ids          = aws_subnet.private[*].id
+  security_group_ids  = [aws_security_group.endpoints[0].id]
+  private_dns_enabled = true
+
+  tags = merge(
+    local.common_tags,
+    {
+      Name = "${local.name_prefix}-${replace(each.value, ".", "-")}-endpoint"
+    }
+  )
+}
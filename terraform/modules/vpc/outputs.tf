@@ -20,5 +20,22 @@ output "nat_gateway_ids" {
 
 output "internet_gateway_id" {
   description = "ID of internet gateway"
-  value       = aws_internet_gateway.main.id
-}
\ No newline at end of file
+  value       = one(aws_internet_gateway.main[*].id)
+}
+output "public_network_acl_id" {
+  description = "ID of the public subnet network ACL"
+  value       = one(aws_network_acl.public[*].id)
+}
+
+output "private_network_acl_id" {
+  description = "ID of the private subnet network ACL"
+  value       = aws_network_acl.private.id
+}
+
+output "vpc_endpoint_ids" {
+  description = "IDs of the VPC endpoints of an airgapped VPC by service"
+  value = merge(
+    { for service, endpoint in aws_vpc_endpoint.interface : service => endpoint.id },
+    { for endpoint in aws_vpc_endpoint.s3 : "s3" => endpoint.id }
+  )
+}
@@ -21,4 +21,16 @@ variable "private_subnets" {
 variable "environment" {
   description = "Environment name"
   type        = string
-}
\ No newline at end of file
+}
+
+variable "airgapped" {
+  description = "Create a private-only VPC without internet or NAT gateways, reaching AWS services through VPC endpoints"
+  type        = bool
+  default     = false
+}
+
+variable "interface_endpoint_services" {
+  description = "AWS services an airgapped VPC reaches through interface endpoints"
+  type        = list(string)
+  default     = ["ecr.api", "ecr.dkr", "sts", "ssm", "ec2", "logs", "monitoring"]
+}
@@ -26,4 +26,13 @@ output "oidc_provider_arn" {
 output "oidc_provider_url" {
   description = "URL of the OIDC provider for IRSA"
   value       = module.iam.oidc_provider_url
-}
\ No newline at end of file
+}
+output "public_subnet_ids" {
+  description = "IDs of the public subnets, none for airgapped VPCs"
+  value       = module.vpc.public_subnet_ids
+}
+
+output "private_subnet_ids" {
+  description = "IDs of the private subnets"
+  value       = module.vpc.private_subnet_ids
+}
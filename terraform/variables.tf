@@ -68,6 +68,12 @@ variable "private_subnets" {
   }
 }
 
+variable "airgapped" {
+  description = "Private-only networking: no internet or NAT gateways, AWS services through VPC endpoints"
+  type        = bool
+  default     = false
+}
+
 variable "state_bucket" {
   description = "S3 bucket for Terraform state"
   type        = string
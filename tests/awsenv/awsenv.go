@@ -0,0 +1,182 @@
+// Aegis AWS Test Environment
+// Region and endpoint the VPC suites apply their fixtures against: a real
+// AWS account, or a local emulator such as LocalStack or moto when
+// AEGIS_AWS_ENDPOINT is set
+
+package awsenv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"aegis-k8s-framework/zones"
+)
+
+// Environment variables configuring the environment; the runner sets them
+// from its -aws-region, -aws-endpoint and -apply-fixtures flags
+const (
+	RegionEnvVar        = "AEGIS_AWS_REGION"
+	EndpointEnvVar      = "AEGIS_AWS_ENDPOINT"
+	ApplyFixturesEnvVar = "AEGIS_APPLY_FIXTURES"
+)
+
+// DefaultRegion is used when AEGIS_AWS_REGION is not set
+const DefaultRegion = "us-east-1"
+
+// emulatorKey is the access key and secret used against the emulator, which
+// accepts any credentials
+const emulatorKey = "test"
+
+// emulatorProviderFile is the provider configuration written into the copy
+// of a module applied against the emulator
+const emulatorProviderFile = "aegis_emulator_provider.tf"
+
+// emulatedServices are the provider endpoints pointed at the emulator: the
+// services the VPC module uses, and the ones the provider calls itself
+var emulatedServices = []string{"ec2", "iam", "logs", "s3", "sts"}
+
+// Region returns the region fixtures are applied in.
+func Region() string {
+	if region := os.Getenv(RegionEnvVar); region != "" {
+		return region
+	}
+	return DefaultRegion
+}
+
+// Endpoint returns the URL of the AWS emulator, or "" for real AWS.
+func Endpoint() string {
+	return strings.TrimRight(os.Getenv(EndpointEnvVar), "/")
+}
+
+// Emulated reports whether fixtures are applied against an AWS emulator.
+func Emulated() bool {
+	return Endpoint() != ""
+}
+
+// AvailabilityZones returns the first count availability zones of the region
+// from the bundled zone catalog. Regions missing from the catalog fall back
+// to the a, b, c... naming most regions use.
+func AvailabilityZones(t *testing.T, count int) []string {
+	catalog, err := zones.LoadCatalog("", nil)
+	require.NoError(t, err)
+
+	regionZones, err := catalog.Zones(Region())
+	if errors.Is(err, zones.ErrUnknownRegion) {
+		names := make([]string, count)
+		for i := range names {
+			names[i] = Region() + string(rune('a'+i))
+		}
+		return names
+	}
+	require.NoError(t, err)
+
+	names := zones.Names(zones.AvailabilityZones(regionZones))
+	require.GreaterOrEqual(t, len(names), count, "%s has fewer than %d availability zones", Region(), count)
+	return names[:count]
+}
+
+// Session returns an AWS session for region, pointed at the emulator when
+// there is one.
+func Session(t *testing.T, region string) *session.Session {
+	config := awssdk.NewConfig().WithRegion(region)
+	if Emulated() {
+		config = config.
+			WithEndpoint(Endpoint()).
+			WithCredentials(credentials.NewStaticCredentials(emulatorKey, emulatorKey, "")).
+			WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSession(config)
+	require.NoError(t, err)
+	return sess
+}
+
+// EC2Client returns an EC2 client for region, pointed at the emulator when
+// there is one.
+func EC2Client(t *testing.T, region string) *ec2.EC2 {
+	return ec2.New(Session(t, region))
+}
+
+// SkipWithoutAWS skips tests that apply a fixture unless AEGIS_APPLY_FIXTURES
+// is true, as fixtures create real infrastructure, and when there is neither
+// an emulator nor AWS credentials.
+func SkipWithoutAWS(t *testing.T) {
+	t.Helper()
+	if testing.Short() || os.Getenv(ApplyFixturesEnvVar) != "true" {
+		t.Skipf("Skipping checks against AWS: applying fixtures is opt-in (-apply-fixtures or %s=true)", ApplyFixturesEnvVar)
+	}
+	if Emulated() {
+		return
+	}
+	sess, err := session.NewSession()
+	if err == nil {
+		_, err = sess.Config.Credentials.Get()
+	}
+	if err != nil {
+		t.Skipf("Skipping checks against AWS: no credentials (%v)", err)
+	}
+}
+
+// SkipOnEmulator skips a check the emulator cannot support, giving the
+// reason so that the report says what was not verified.
+func SkipOnEmulator(t *testing.T, reason string) {
+	t.Helper()
+	if Emulated() {
+		t.Skipf("Skipping on the AWS emulator at %s: %s", Endpoint(), reason)
+	}
+}
+
+// Configure points terraform at the region and, in emulated mode, at the
+// emulator by writing a provider configuration into options.TerraformDir.
+// That must be a copy of the module, such as one made with
+// files.CopyTerraformFolderToTemp, so that the configuration never ends up
+// in the repository.
+func Configure(t *testing.T, options *terraform.Options) *terraform.Options {
+	if options.EnvVars == nil {
+		options.EnvVars = map[string]string{}
+	}
+	options.EnvVars["AWS_REGION"] = Region()
+	options.EnvVars["AWS_DEFAULT_REGION"] = Region()
+	if !Emulated() {
+		return options
+	}
+
+	path := filepath.Join(options.TerraformDir, emulatorProviderFile)
+	err := os.WriteFile(path, []byte(emulatorProvider(Region(), Endpoint())), 0o644)
+	require.NoError(t, err)
+	return options
+}
+
+// emulatorProvider returns an AWS provider configuration that sends every
+// request for the emulated services to endpoint and skips the account and
+// credential checks the emulator cannot answer.
+func emulatorProvider(region, endpoint string) string {
+	var endpoints strings.Builder
+	for _, service := range emulatedServices {
+		fmt.Fprintf(&endpoints, "    %-4s = %q\n", service, endpoint)
+	}
+	return fmt.Sprintf(`provider "aws" {
+  region                      = %q
+  access_key                  = %q
+  secret_key                  = %q
+  skip_credentials_validation = true
+  skip_metadata_api_check     = true
+  skip_region_validation      = true
+  skip_requesting_account_id  = true
+  s3_use_path_style           = true
+
+  endpoints {
+%s  }
+}
+`, region, emulatorKey, emulatorKey, endpoints.String())
+}
@@ -0,0 +1,166 @@
+// Aegis Kubernetes Framework - Compliance Reports
+// Status of the compliance controls registered by the test suites, built
+// from the results of a test run
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"aegis-kubernetes-framework/tests/registry"
+)
+
+// Control statuses
+const (
+	controlPass       = "PASS"
+	controlFail       = "FAIL"
+	controlIncomplete = "INCOMPLETE" // Some evidence suites were skipped or not run
+	controlNotRun     = "NOT RUN"
+)
+
+// ControlEvidence is the outcome of one suite that provides evidence for a control
+type ControlEvidence struct {
+	Suite  string `json:"suite"`
+	Status string `json:"status"`
+}
+
+// ControlStatus is the compliance status of a single control
+type ControlStatus struct {
+	Control  registry.Control  `json:"control"`
+	Status   string            `json:"status"`
+	LastRun  *time.Time        `json:"lastRun,omitempty"`
+	Evidence []ControlEvidence `json:"evidence"`
+}
+
+// complianceStatus evaluates every control referenced by the registry
+// against the results of a run. A control passes only when all of its
+// evidence suites ran and passed.
+func complianceStatus(suites []TestSuite, results []TestResult) []ControlStatus {
+	resultsBySuite := make(map[string]TestResult, len(results))
+	for _, result := range results {
+		resultsBySuite[result.TestSuite.Name] = result
+	}
+
+	statusByControl := make(map[registry.Control]*ControlStatus)
+	var controls []registry.Control
+	for _, suite := range suites {
+		for _, control := range suite.Controls {
+			status, ok := statusByControl[control]
+			if !ok {
+				status = &ControlStatus{Control: control}
+				statusByControl[control] = status
+				controls = append(controls, control)
+			}
+
+			evidence := ControlEvidence{Suite: suite.Name, Status: controlNotRun}
+			if result, ran := resultsBySuite[suite.Name]; ran {
+				evidence.Status = result.Status()
+				if finished := result.StartTime.Add(result.Duration); status.LastRun == nil || finished.After(*status.LastRun) {
+					status.LastRun = &finished
+				}
+			}
+			status.Evidence = append(status.Evidence, evidence)
+		}
+	}
+
+	sort.Slice(controls, func(i, j int) bool {
+		if controls[i].Framework != controls[j].Framework {
+			return controls[i].Framework < controls[j].Framework
+		}
+		return controls[i].ControlID < controls[j].ControlID
+	})
+
+	statuses := make([]ControlStatus, 0, len(controls))
+	for _, control := range controls {
+		status := statusByControl[control]
+		status.Status = controlStatusFromEvidence(status.Evidence)
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+func controlStatusFromEvidence(evidence []ControlEvidence) string {
+	passed, failed := 0, 0
+	for _, e := range evidence {
+		switch e.Status {
+		case "PASS":
+			passed++
+		case "FAIL":
+			failed++
+		}
+	}
+
+	switch {
+	case failed > 0:
+		return controlFail
+	case passed == len(evidence):
+		return controlPass
+	case passed > 0:
+		return controlIncomplete
+	default:
+		return controlNotRun
+	}
+}
+
+// complianceJSONReporter exports the control status for auditors as JSON
+type complianceJSONReporter struct{}
+
+type complianceJSONReport struct {
+	Environment string          `json:"environment"`
+	Generated   time.Time       `json:"generated"`
+	Controls    []ControlStatus `json:"controls"`
+}
+
+func (complianceJSONReporter) FileName() string { return "compliance-report.json" }
+
+func (complianceJSONReporter) Write(w io.Writer, tr *TestRunner) error {
+	report := complianceJSONReport{
+		Environment: tr.Environment,
+		Generated:   tr.EndTime,
+		Controls:    complianceStatus(testSuites, tr.Results),
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// complianceCSVReporter exports the control status for auditors as CSV,
+// one row per control
+type complianceCSVReporter struct{}
+
+func (complianceCSVReporter) FileName() string { return "compliance-report.csv" }
+
+func (complianceCSVReporter) Write(w io.Writer, tr *TestRunner) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Framework", "Control", "Status", "Last Run", "Evidence"})
+
+	for _, status := range complianceStatus(testSuites, tr.Results) {
+		lastRun := ""
+		if status.LastRun != nil {
+			lastRun = status.LastRun.Format(time.RFC3339)
+		}
+
+		evidence := make([]string, 0, len(status.Evidence))
+		for _, e := range status.Evidence {
+			evidence = append(evidence, fmt.Sprintf("%s (%s)", e.Suite, e.Status))
+		}
+
+		writer.Write([]string{
+			status.Control.Framework,
+			status.Control.ControlID,
+			status.Status,
+			lastRun,
+			strings.Join(evidence, "; "),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
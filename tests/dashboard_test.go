@@ -0,0 +1,221 @@
+// Aegis Kubernetes Framework - HTML Dashboard
+// Self-contained HTML report with no external assets, so it can be archived
+// as a CI artifact and opened offline
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// htmlReporter writes a single-file HTML dashboard
+type htmlReporter struct{}
+
+type dashboardData struct {
+	Environment string
+	Generated   string
+	Duration    string
+	Summary     runSummary
+	SuccessRate string
+	Categories  []dashboardCategory
+	Failures    []TestResult
+	Controls    []ControlStatus
+	Durations   []dashboardDuration
+}
+
+type dashboardCategory struct {
+	Name        string
+	Total       int
+	Passed      int
+	Failed      int
+	Skipped     int
+	PassPercent float64
+}
+
+type dashboardDuration struct {
+	Name    string
+	Status  string
+	Seconds float64
+	Percent float64 // of the slowest suite
+}
+
+func (htmlReporter) FileName() string { return "dashboard.html" }
+
+func (htmlReporter) Write(w io.Writer, tr *TestRunner) error {
+	stats := summarize(tr.Results)
+	data := dashboardData{
+		Environment: tr.Environment,
+		Generated:   tr.EndTime.Format(time.RFC3339),
+		Duration:    tr.EndTime.Sub(tr.StartTime).Round(time.Millisecond).String(),
+		Summary:     stats,
+		SuccessRate: "n/a",
+		Controls:    complianceStatus(testSuites, tr.Results),
+	}
+	if successRate, ok := stats.SuccessRate(); ok {
+		data.SuccessRate = formatPercent(successRate)
+	}
+
+	categoryIndex := make(map[string]int)
+	var slowest time.Duration
+	for _, result := range tr.Results {
+		index, ok := categoryIndex[result.TestSuite.Category]
+		if !ok {
+			index = len(data.Categories)
+			categoryIndex[result.TestSuite.Category] = index
+			data.Categories = append(data.Categories, dashboardCategory{Name: result.TestSuite.Category})
+		}
+		category := &data.Categories[index]
+		category.Total++
+		switch result.Status() {
+		case "PASS":
+			category.Passed++
+		case "FAIL":
+			category.Failed++
+			data.Failures = append(data.Failures, result)
+		case "SKIP":
+			category.Skipped++
+		}
+
+		if result.Duration > slowest {
+			slowest = result.Duration
+		}
+	}
+	for i := range data.Categories {
+		category := &data.Categories[i]
+		if ran := category.Total - category.Skipped; ran > 0 {
+			category.PassPercent = float64(category.Passed) / float64(ran) * 100
+		}
+	}
+
+	for _, result := range tr.Results {
+		duration := dashboardDuration{
+			Name:    result.TestSuite.Name,
+			Status:  result.Status(),
+			Seconds: result.Duration.Seconds(),
+		}
+		if slowest > 0 {
+			duration.Percent = float64(result.Duration) / float64(slowest) * 100
+		}
+		data.Durations = append(data.Durations, duration)
+	}
+	sort.SliceStable(data.Durations, func(i, j int) bool {
+		return data.Durations[i].Seconds > data.Durations[j].Seconds
+	})
+
+	return dashboardTemplate.Execute(w, data)
+}
+
+func formatPercent(value float64) string {
+	return fmt.Sprintf("%.1f%%", value)
+}
+
+// statusClass maps a result or control status to its CSS class
+func statusClass(status string) string {
+	return strings.ReplaceAll(strings.ToLower(status), " ", "-")
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"percent":     formatPercent,
+	"statusClass": statusClass,
+}).Parse(dashboardHTML))
+
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Aegis Test Dashboard - {{.Environment}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem; color: #1f2328; background: #f6f8fa; }
+h1 { margin-bottom: 0.25rem; }
+h2 { margin-top: 2rem; }
+.meta { color: #59636e; }
+.cards { display: flex; flex-wrap: wrap; gap: 1rem; margin-top: 1.5rem; }
+.card { background: #fff; border: 1px solid #d1d9e0; border-radius: 6px; padding: 1rem 1.5rem; min-width: 8rem; }
+.card .value { font-size: 2rem; font-weight: 600; }
+.card .label { color: #59636e; }
+table { border-collapse: collapse; width: 100%; background: #fff; }
+th, td { border: 1px solid #d1d9e0; padding: 0.4rem 0.6rem; text-align: left; vertical-align: top; }
+th { background: #eef1f4; }
+.bar { background: #eef1f4; height: 0.8rem; border-radius: 3px; min-width: 10rem; }
+.bar span { display: block; height: 100%; border-radius: 3px; background: #1f883d; }
+.bar.duration span { background: #0969da; }
+.pass { color: #1a7f37; font-weight: 600; }
+.fail, .incomplete { color: #cf222e; font-weight: 600; }
+.skip, .not-run { color: #9a6700; font-weight: 600; }
+.failure { background: #fff; border: 1px solid #d1d9e0; border-left: 4px solid #cf222e; border-radius: 6px; padding: 0.5rem 1rem; margin-bottom: 1rem; }
+pre { background: #f6f8fa; padding: 0.75rem; overflow-x: auto; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Aegis Test Dashboard</h1>
+<div class="meta">Environment: {{.Environment}} &middot; Generated: {{.Generated}} &middot; Duration: {{.Duration}}</div>
+
+<div class="cards">
+<div class="card"><div class="value">{{.Summary.Total}}</div><div class="label">Total</div></div>
+<div class="card"><div class="value pass">{{.Summary.Passed}}</div><div class="label">Passed</div></div>
+<div class="card"><div class="value fail">{{.Summary.Failed}}</div><div class="label">Failed</div></div>
+<div class="card"><div class="value skip">{{.Summary.Skipped}}</div><div class="label">Skipped</div></div>
+<div class="card"><div class="value">{{.SuccessRate}}</div><div class="label">Success Rate</div></div>
+</div>
+
+<h2>Categories</h2>
+{{- if .Categories}}
+<table>
+<tr><th>Category</th><th>Total</th><th>Passed</th><th>Failed</th><th>Skipped</th><th>Pass Rate</th></tr>
+{{- range .Categories}}
+<tr><td>{{.Name}}</td><td>{{.Total}}</td><td>{{.Passed}}</td><td>{{.Failed}}</td><td>{{.Skipped}}</td>
+<td><div class="bar"><span style="width: {{printf "%.1f" .PassPercent}}%"></span></div>{{percent .PassPercent}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No tests were run.</p>
+{{- end}}
+
+<h2>Failures</h2>
+{{- range .Failures}}
+<div class="failure">
+<h3>{{.TestSuite.Name}}: {{.TestSuite.Description}}</h3>
+<pre>{{.Error}}</pre>
+{{- if .Output}}
+<details><summary>Output</summary><pre>{{.Output}}</pre></details>
+{{- end}}
+</div>
+{{- else}}
+<p>No failures.</p>
+{{- end}}
+
+<h2>Compliance</h2>
+{{- if .Controls}}
+<table>
+<tr><th>Framework</th><th>Control</th><th>Status</th><th>Last Run</th><th>Evidence</th></tr>
+{{- range .Controls}}
+<tr><td>{{.Control.Framework}}</td><td>{{.Control.ControlID}}</td>
+<td class="{{statusClass .Status}}">{{.Status}}</td>
+<td>{{if .LastRun}}{{.LastRun.Format "2006-01-02 15:04:05"}}{{else}}-{{end}}</td>
+<td>{{range $i, $e := .Evidence}}{{if $i}}, {{end}}<span class="{{statusClass $e.Status}}">{{$e.Suite}}</span>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No compliance controls are mapped.</p>
+{{- end}}
+
+<h2>Durations</h2>
+{{- if .Durations}}
+<table>
+<tr><th>Suite</th><th>Status</th><th>Duration</th><th></th></tr>
+{{- range .Durations}}
+<tr><td>{{.Name}}</td><td class="{{statusClass .Status}}">{{.Status}}</td><td>{{printf "%.2fs" .Seconds}}</td>
+<td><div class="bar duration"><span style="width: {{printf "%.1f" .Percent}}%"></span></div></td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No tests were run.</p>
+{{- end}}
+</body>
+</html>
+`
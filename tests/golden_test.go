@@ -0,0 +1,165 @@
+// Aegis Kubernetes Framework - Reporter Golden Files
+// Renders fixed runs in every report format and compares them with the files
+// in testdata/golden. After an intended change to a report format, rewrite
+// them without running any suite:
+//
+//	go test . -run TestReporterGolden -update -match='^$' -history=false
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "Rewrite the reporter golden files")
+
+// goldenRuns are the fixed runs rendered by the golden tests
+func goldenRuns(t *testing.T) map[string]*TestRunner {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	suite := func(name string) TestSuite {
+		s, ok := findSuite(name)
+		require.True(t, ok, "suite %s is not registered", name)
+		return s
+	}
+
+	mixed := &TestRunner{
+		Environment:   "staging",
+		ReportFormats: []string{"text"},
+		StartTime:     start,
+		EndTime:       start.Add(95 * time.Second),
+		Results: []TestResult{
+			{
+				TestSuite: suite("VPC-UNIT-001"),
+				Passed:    true,
+				StartTime: start,
+				Duration:  1500 * time.Millisecond,
+				Output:    "=== RUN   TestRegisteredSuite\n--- PASS: TestRegisteredSuite (1.50s)\nPASS\n",
+			},
+			{
+				TestSuite: suite("VPC-SEC-002"),
+				Passed:    false,
+				StartTime: start.Add(2 * time.Second),
+				Duration:  90 * time.Second,
+				Error:     errors.New("Should be true: security group allows 0.0.0.0/0 on port 22 | <sg-123>"),
+				Output:    "=== RUN   TestRegisteredSuite\n    Error: Should be true\n--- FAIL: TestRegisteredSuite (90.00s)\nFAIL\n",
+			},
+			{
+				TestSuite: suite("VPC-INT-003"),
+				Passed:    true,
+				Skipped:   true,
+				StartTime: start.Add(2 * time.Second),
+				Duration:  250 * time.Millisecond,
+				Output:    "=== RUN   TestRegisteredSuite\n--- SKIP: TestRegisteredSuite (0.25s)\n",
+			},
+		},
+	}
+
+	empty := &TestRunner{
+		Environment: "production",
+		StartTime:   start,
+		EndTime:     start.Add(10 * time.Millisecond),
+	}
+
+	return map[string]*TestRunner{"mixed": mixed, "empty": empty}
+}
+
+func TestReporterGolden(t *testing.T) {
+	for scenario, runner := range goldenRuns(t) {
+		for format, reporter := range reporters {
+			t.Run(scenario+"/"+format, func(t *testing.T) {
+				var got bytes.Buffer
+				require.NoError(t, reporter.Write(&got, runner))
+
+				golden := filepath.Join("testdata", "golden", scenario, reporter.FileName())
+				if *updateGolden {
+					require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0755))
+					require.NoError(t, os.WriteFile(golden, got.Bytes(), 0644))
+				}
+
+				want, err := os.ReadFile(golden)
+				require.NoError(t, err, "missing golden file; run with -update to create it")
+				assert.Equal(t, string(want), got.String())
+			})
+		}
+	}
+}
+
+func TestGenerateReportWritesEveryFormat(t *testing.T) {
+	runner := goldenRuns(t)["empty"]
+	runner.ReportDir = filepath.Join(t.TempDir(), "reports")
+	for format := range reporters {
+		runner.ReportFormats = append(runner.ReportFormats, format)
+	}
+
+	require.NoError(t, runner.GenerateReport())
+
+	entries, err := os.ReadDir(runner.ReportDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, len(reporters))
+	for _, entry := range entries {
+		assert.False(t, strings.Contains(entry.Name(), ".tmp-"), "temporary file %s left behind", entry.Name())
+	}
+
+	text, err := os.ReadFile(filepath.Join(runner.ReportDir, "test-summary.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(text), "Success Rate: n/a")
+	assert.NotContains(t, string(text), "NaN")
+}
+
+func TestGenerateReportReturnsErrors(t *testing.T) {
+	// A file where the report directory should be
+	blocker := filepath.Join(t.TempDir(), "reports")
+	require.NoError(t, os.WriteFile(blocker, nil, 0644))
+
+	runner := goldenRuns(t)["mixed"]
+	runner.ReportDir = blocker
+	assert.Error(t, runner.GenerateReport())
+
+	// A directory where the report file should be
+	runner.ReportDir = t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(runner.ReportDir, "test-summary.txt"), 0755))
+	assert.Error(t, runner.GenerateReport())
+}
+
+func TestWriteFileAtomicReplacesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.txt")
+	require.NoError(t, os.WriteFile(path, []byte("old report"), 0644))
+
+	require.NoError(t, writeFileAtomic(path, []byte("new report")))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new report", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestPolicyViolations(t *testing.T) {
+	runner := goldenRuns(t)["mixed"]
+
+	// VPC-SEC-002 (priority 1) failed
+	assert.Len(t, runner.PolicyViolations(1, 0, false), 1)
+	assert.Empty(t, runner.PolicyViolations(0, 0, false))
+
+	// One of the two suites that ran passed; the skipped one counts only
+	// with skipsFail
+	assert.Empty(t, runner.PolicyViolations(0, 50, false))
+	assert.Equal(t, []string{"success rate 33.3% is below the required 50.0%"}, runner.PolicyViolations(0, 50, true))
+
+	skipped := &TestRunner{Results: runner.Results[2:]}
+	assert.Equal(t, []string{"all 1 suites skipped, so the required success rate of 100.0% is not met"},
+		skipped.PolicyViolations(0, 100, false))
+	assert.Empty(t, skipped.PolicyViolations(0, 0, false))
+}
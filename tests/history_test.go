@@ -0,0 +1,90 @@
+// Aegis Kubernetes Framework - Test History
+// Appends the results of every run to a JSON-lines store in the report
+// directory; `aegis report trends` reads it back for trend analysis
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// historyFile is the results store within the report directory
+const historyFile = "history.jsonl"
+
+// HistoryRun is one line of the results store
+type HistoryRun struct {
+	RunID       string          `json:"runId"`
+	Environment string          `json:"environment"`
+	GitCommit   string          `json:"gitCommit"`
+	StartTime   time.Time       `json:"startTime"`
+	EndTime     time.Time       `json:"endTime"`
+	Results     []HistoryResult `json:"results"`
+}
+
+// HistoryResult is the outcome of one suite within a stored run
+type HistoryResult struct {
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Priority int     `json:"priority"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"durationSeconds"`
+}
+
+// RecordHistory appends the results of the run to the results store
+func (tr *TestRunner) RecordHistory() error {
+	run := HistoryRun{
+		RunID:       fmt.Sprintf("%s-%d", tr.StartTime.UTC().Format("20060102T150405Z"), os.Getpid()),
+		Environment: tr.Environment,
+		GitCommit:   gitCommit(),
+		StartTime:   tr.StartTime,
+		EndTime:     tr.EndTime,
+		Results:     make([]HistoryResult, 0, len(tr.Results)),
+	}
+	for _, result := range tr.Results {
+		run.Results = append(run.Results, HistoryResult{
+			Name:     result.TestSuite.Name,
+			Category: result.TestSuite.Category,
+			Priority: result.TestSuite.Priority,
+			Status:   result.Status(),
+			Duration: result.Duration.Seconds(),
+		})
+	}
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(tr.ReportDir, 0755); err != nil {
+		return err
+	}
+	store, err := os.OpenFile(filepath.Join(tr.ReportDir, historyFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := store.Write(append(line, '\n')); err != nil {
+		store.Close()
+		return err
+	}
+	return store.Close()
+}
+
+// gitCommit returns the commit under test, preferring the CI environment
+func gitCommit() string {
+	for _, key := range []string{"GITHUB_SHA", "CI_COMMIT_SHA", "GIT_COMMIT"} {
+		if commit := os.Getenv(key); commit != "" {
+			return commit
+		}
+	}
+	output, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(output))
+}
@@ -9,10 +9,19 @@ import (
 	"strings"
 	"testing"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
+
+	"aegis-kubernetes-framework/tests/registry"
 )
 
-// TestIAM-UNIT-001: Validate IAM policy document generation
+var _ = registry.Register(registry.Suite{
+	Name:        "IAM-UNIT-001",
+	Description: "Validate IAM policy document generation",
+	Category:    "iam",
+	Priority:    1,
+	Tags:        []string{registry.TagUnit},
+	TestFunc:    TestIAMPolicyDocumentGeneration,
+})
+
 func TestIAMPolicyDocumentGeneration(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -81,7 +90,15 @@ func TestIAMPolicyDocumentGeneration(t *testing.T) {
 	}
 }
 
-// TestIAM-UNIT-002: Test role assumption logic
+var _ = registry.Register(registry.Suite{
+	Name:        "IAM-UNIT-002",
+	Description: "Test role assumption logic",
+	Category:    "iam",
+	Priority:    1,
+	Tags:        []string{registry.TagUnit},
+	TestFunc:    TestRoleAssumptionLogic,
+})
+
 func TestRoleAssumptionLogic(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -158,7 +175,15 @@ func TestRoleAssumptionLogic(t *testing.T) {
 	}
 }
 
-// TestIAM-UNIT-003: Validate permission boundary application
+var _ = registry.Register(registry.Suite{
+	Name:        "IAM-UNIT-003",
+	Description: "Validate permission boundary application",
+	Category:    "iam",
+	Priority:    1,
+	Tags:        []string{registry.TagUnit},
+	TestFunc:    TestPermissionBoundaryApplication,
+})
+
 func TestPermissionBoundaryApplication(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -230,7 +255,15 @@ func TestPermissionBoundaryApplication(t *testing.T) {
 	}
 }
 
-// TestIAM-UNIT-004: Test OIDC provider configuration
+var _ = registry.Register(registry.Suite{
+	Name:        "IAM-UNIT-004",
+	Description: "Test OIDC provider configuration",
+	Category:    "iam",
+	Priority:    1,
+	Tags:        []string{registry.TagUnit},
+	TestFunc:    TestOIDCProviderConfiguration,
+})
+
 func TestOIDCProviderConfiguration(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -5,14 +5,25 @@ package kyverno
 
 import (
 	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
+
+	"aegis-kubernetes-framework/tests/registry"
 )
 
-// TestKyverno-UNIT-001: Validate policy YAML syntax
+var _ = registry.Register(registry.Suite{
+	Name:        "Kyverno-UNIT-001",
+	Description: "Validate policy YAML syntax",
+	Category:    "kyverno",
+	Priority:    1,
+	Tags:        []string{registry.TagUnit},
+	TestFunc:    TestKyvernoPolicySyntax,
+})
+
 func TestKyvernoPolicySyntax(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -112,7 +123,15 @@ spec:
 	}
 }
 
-// TestKyverno-UNIT-002: Test rule logic validation
+var _ = registry.Register(registry.Suite{
+	Name:        "Kyverno-UNIT-002",
+	Description: "Test rule logic validation",
+	Category:    "kyverno",
+	Priority:    1,
+	Tags:        []string{registry.TagUnit},
+	TestFunc:    TestKyvernoRuleLogic,
+})
+
 func TestKyvernoRuleLogic(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -242,7 +261,15 @@ func TestKyvernoRuleLogic(t *testing.T) {
 	}
 }
 
-// TestKyverno-UNIT-003: Validate variable substitution
+var _ = registry.Register(registry.Suite{
+	Name:        "Kyverno-UNIT-003",
+	Description: "Validate variable substitution",
+	Category:    "kyverno",
+	Priority:    1,
+	Tags:        []string{registry.TagUnit},
+	TestFunc:    TestKyvernoVariableSubstitution,
+})
+
 func TestKyvernoVariableSubstitution(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -316,7 +343,15 @@ func TestKyvernoVariableSubstitution(t *testing.T) {
 	}
 }
 
-// TestKyverno-UNIT-004: Test policy precedence
+var _ = registry.Register(registry.Suite{
+	Name:        "Kyverno-UNIT-004",
+	Description: "Test policy precedence",
+	Category:    "kyverno",
+	Priority:    1,
+	Tags:        []string{registry.TagUnit},
+	TestFunc:    TestKyvernoPolicyPrecedence,
+})
+
 func TestKyvernoPolicyPrecedence(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -370,7 +405,7 @@ func TestKyvernoPolicyPrecedence(t *testing.T) {
 			},
 			expectedResult: PolicyResult{
 				Allowed: true,
-				Reason:  "Policy validation passed",
+				Reason:  "All policies passed",
 			},
 		},
 		{
@@ -461,6 +496,9 @@ func ValidateKyvernoPolicy(policyYAML string) (bool, int, error) {
 	if policy.APIVersion != "kyverno.io/v1" || policy.Kind != "ClusterPolicy" {
 		return false, 0, fmt.Errorf("invalid policy structure")
 	}
+	if len(policy.Spec.Rules) == 0 {
+		return false, 0, fmt.Errorf("policy %s has no rules", policy.Metadata.Name)
+	}
 
 	return true, len(policy.Spec.Rules), nil
 }
@@ -496,37 +534,50 @@ func EvaluateKyvernoRule(rule KyvernoRule, input map[string]interface{}) (bool,
 	return true, nil
 }
 
+// SubstituteVariables resolves a template that is a single {{ path }}
+// variable, such as request.object.spec.containers[0].image, against context.
+// Anything else is returned unchanged.
 func SubstituteVariables(template string, context map[string]interface{}) (string, error) {
-	// Simplified variable substitution
-	if strings.Contains(template, "{{ request.object.metadata.name }}") {
-		if request, ok := context["request"].(map[string]interface{}); ok {
-			if object, ok := request["object"].(map[string]interface{}); ok {
-				if metadata, ok := object["metadata"].(map[string]interface{}); ok {
-					if name, ok := metadata["name"].(string); ok {
-						return name, nil
-					}
-				}
+	expression := strings.TrimSpace(template)
+	if !strings.HasPrefix(expression, "{{") || !strings.HasSuffix(expression, "}}") {
+		return template, nil
+	}
+	path := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(expression, "{{"), "}}"))
+
+	var value interface{} = context
+	for _, field := range strings.Split(path, ".") {
+		name, index, hasIndex := field, 0, false
+		if open := strings.Index(field, "["); open >= 0 && strings.HasSuffix(field, "]") {
+			parsed, err := strconv.Atoi(field[open+1 : len(field)-1])
+			if err != nil {
+				return "", fmt.Errorf("invalid index in %s", field)
 			}
+			name, index, hasIndex = field[:open], parsed, true
 		}
-		return "", fmt.Errorf("variable not found")
-	}
 
-	if strings.Contains(template, "{{ request.object.spec.containers[0].image }}") {
-		if request, ok := context["request"].(map[string]interface{}); ok {
-			if object, ok := request["object"].(map[string]interface{}); ok {
-				if spec, ok := object["spec"].(map[string]interface{}); ok {
-					if containers, ok := spec["containers"].([]map[string]interface{}); ok && len(containers) > 0 {
-						if image, ok := containers[0]["image"].(string); ok {
-							return image, nil
-						}
-					}
-				}
-			}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("variable %s not found", path)
+		}
+		if value, ok = object[name]; !ok {
+			return "", fmt.Errorf("variable %s not found", path)
 		}
-		return "", fmt.Errorf("variable not found")
+		if !hasIndex {
+			continue
+		}
+
+		list := reflect.ValueOf(value)
+		if list.Kind() != reflect.Slice || index < 0 || index >= list.Len() {
+			return "", fmt.Errorf("variable %s not found", path)
+		}
+		value = list.Index(index).Interface()
 	}
 
-	return template, nil
+	switch value.(type) {
+	case map[string]interface{}, []interface{}, []map[string]interface{}:
+		return "", fmt.Errorf("variable %s is not a scalar", path)
+	}
+	return fmt.Sprint(value), nil
 }
 
 func EvaluatePolicyPrecedence(policies []KyvernoPolicy, input map[string]interface{}) PolicyResult {
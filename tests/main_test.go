@@ -4,26 +4,36 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"aegis-kubernetes-framework/tests/awsenv"
+	"aegis-kubernetes-framework/tests/registry"
+
+	// Test packages register their suites when imported
+	_ "aegis-kubernetes-framework/tests/iam/unit"
+	_ "aegis-kubernetes-framework/tests/kyverno/unit"
+	_ "aegis-kubernetes-framework/tests/vpc/compliance"
+	_ "aegis-kubernetes-framework/tests/vpc/integration"
+	_ "aegis-kubernetes-framework/tests/vpc/security"
+	_ "aegis-kubernetes-framework/tests/vpc/unit"
 )
 
 // TestSuite represents a collection of tests
-type TestSuite struct {
-	Name        string
-	Description string
-	TestFunc    func(t *testing.T)
-	Category    string
-	Priority    int // 1=Critical, 2=High, 3=Medium, 4=Low
-}
+type TestSuite = registry.Suite
 
 // Global test configuration
 var (
@@ -31,161 +41,37 @@ var (
 	verbose         = flag.Bool("verbose", false, "Enable verbose output")
 	reportDir       = flag.String("report-dir", "reports", "Directory for test reports")
 	parallel        = flag.Bool("parallel", true, "Run tests in parallel")
+	workers         = flag.Int("workers", runtime.NumCPU(), "Number of suites to run concurrently when -parallel is set")
 	categories      = flag.String("categories", "all", "Test categories to run (comma-separated)")
+	ids             = flag.String("ids", "", "Only run these suite IDs (comma-separated)")
+	exclude         = flag.String("exclude", "", "Never run these suite IDs (comma-separated)")
+	match           = flag.String("match", "", "Only run suites whose ID matches this regular expression")
+	tags            = flag.String("suite-tags", "", "Only run suites with one of these tags (comma-separated: unit, integration, security, compliance)")
+	priority        = flag.String("priority", "", "Only run suites in this priority range, e.g. 1, 1-2 or 2- (overrides the -env default)")
+	list            = flag.Bool("list-suites", false, "List the selected suites without running them")
+	reportFormat    = flag.String("report-format", "text,html", "Report formats to write (comma-separated: text, junit, json, markdown, html, compliance-json, compliance-csv)")
+	failOnPriority  = flag.Int("fail-on-priority", 4, "Fail the run when a suite of this priority or more critical fails (1=Critical, 4=Low, 0=never)")
+	minSuccessRate  = flag.Float64("min-success-rate", 0, "Fail the run when fewer than this percentage of the suites that ran pass")
+	skipsFail       = flag.Bool("skips-fail", false, "Count skipped suites as failed towards -min-success-rate")
+	recordHistory   = flag.Bool("history", true, "Append results to the history store in the report directory")
+	suiteTimeout    = flag.Duration("suite-timeout", 60*time.Minute, "Maximum duration of a single test suite")
+	awsRegion       = flag.String("aws-region", "", "AWS region to apply fixtures in (default "+awsenv.DefaultRegion+")")
+	awsEndpoint     = flag.String("aws-endpoint", "", "Apply fixtures against the AWS emulator (LocalStack, moto) at this URL instead of AWS")
+	applyFixtures   = flag.Bool("apply-fixtures", false, "Let suites apply their fixtures to AWS or the emulator (never with -short)")
 )
 
-// Test Suites Registry
-var testSuites = []TestSuite{
-	// VPC Module Tests
-	{
-		Name:        "VPC-UNIT-001",
-		Description: "Validate CIDR block calculations and subnet allocations",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-UNIT-002",
-		Description: "Test availability zone distribution logic",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-UNIT-003",
-		Description: "Validate route table creation and association rules",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-UNIT-004",
-		Description: "Test Network ACL rule generation",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-INT-001",
-		Description: "Test VPC creation with all subnets and gateways",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-INT-002",
-		Description: "Validate NAT gateway functionality",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-INT-003",
-		Description: "Test cross-subnet communication",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-INT-004",
-		Description: "Validate route table associations",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-SEC-001",
-		Description: "Test default security posture",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-SEC-002",
-		Description: "Validate network isolation",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-SEC-003",
-		Description: "Test NACL rule enforcement",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-SEC-004",
-		Description: "Validate VPC flow logs",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-COMP-001",
-		Description: "CIS AWS Foundations Benchmark 3.1",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-COMP-002",
-		Description: "NIST Cybersecurity Framework PR.AC-5",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-COMP-003",
-		Description: "ISO 27001 A.13.1.1",
-		Category:    "vpc",
-		Priority:    1,
-	},
-	{
-		Name:        "VPC-COMP-004",
-		Description: "SOC 2 CC6.1",
-		Category:    "vpc",
-		Priority:    1,
-	},
-
-	// IAM Module Tests
-	{
-		Name:        "IAM-UNIT-001",
-		Description: "Validate IAM policy document generation",
-		Category:    "iam",
-		Priority:    1,
-	},
-	{
-		Name:        "IAM-UNIT-002",
-		Description: "Test role assumption logic",
-		Category:    "iam",
-		Priority:    1,
-	},
-	{
-		Name:        "IAM-UNIT-003",
-		Description: "Validate permission boundary application",
-		Category:    "iam",
-		Priority:    1,
-	},
-	{
-		Name:        "IAM-UNIT-004",
-		Description: "Test OIDC provider configuration",
-		Category:    "iam",
-		Priority:    1,
-	},
-
-	// Kyverno Policy Tests
-	{
-		Name:        "Kyverno-UNIT-001",
-		Description: "Validate policy YAML syntax",
-		Category:    "kyverno",
-		Priority:    1,
-	},
-	{
-		Name:        "Kyverno-UNIT-002",
-		Description: "Test rule logic validation",
-		Category:    "kyverno",
-		Priority:    1,
-	},
-	{
-		Name:        "Kyverno-UNIT-003",
-		Description: "Validate variable substitution",
-		Category:    "kyverno",
-		Priority:    1,
-	},
-	{
-		Name:        "Kyverno-UNIT-004",
-		Description: "Test policy precedence",
-		Category:    "kyverno",
-		Priority:    1,
-	},
-}
+// suiteEnvVar names the suite a re-executed test binary should run.
+const suiteEnvVar = "AEGIS_TEST_SUITE"
+
+// teardownEnvVar names the package directory whose fixture teardown a
+// re-executed test binary should run.
+const teardownEnvVar = "AEGIS_TEST_TEARDOWN"
+
+// Test Suites Registry, built from the suites registered by the test packages
+var testSuites = registry.Suites()
+
+// Fixture teardowns registered by the test packages
+var registeredTeardowns = registry.Teardowns()
 
 // TestRunner manages test execution
 type TestRunner struct {
@@ -193,32 +79,58 @@ type TestRunner struct {
 	Verbose       bool
 	ReportDir     string
 	Parallel      bool
+	Workers       int
 	Categories    []string
+	Selection     Selection
+	ReportFormats []string
 	StartTime     time.Time
 	EndTime       time.Time
 	Results       []TestResult
+	Teardowns     []error // Fixture teardowns that failed
 }
 
 // TestResult represents the outcome of a test
 type TestResult struct {
-	TestSuite   TestSuite
-	Passed      bool
-	Duration    time.Duration
-	Error       error
-	Output      string
+	TestSuite TestSuite
+	Passed    bool
+	Skipped   bool
+	StartTime time.Time
+	Duration  time.Duration
+	Error     error
+	Output    string
+}
+
+// Status returns PASS, FAIL or SKIP.
+func (r TestResult) Status() string {
+	switch {
+	case !r.Passed:
+		return "FAIL"
+	case r.Skipped:
+		return "SKIP"
+	default:
+		return "PASS"
+	}
 }
 
 // NewTestRunner creates a new test runner
-func NewTestRunner() *TestRunner {
-	return &TestRunner{
-		Environment: *testEnvironment,
-		Verbose:     *verbose,
-		ReportDir:   *reportDir,
-		Parallel:    *parallel,
-		Categories:  strings.Split(*categories, ","),
-		StartTime:   time.Now(),
-		Results:     make([]TestResult, 0),
+func NewTestRunner() (*TestRunner, error) {
+	selection, err := parseSelection(*ids, *exclude, *match, *tags, *priority)
+	if err != nil {
+		return nil, err
 	}
+
+	return &TestRunner{
+		Environment:   *testEnvironment,
+		Verbose:       *verbose,
+		ReportDir:     *reportDir,
+		Parallel:      *parallel,
+		Workers:       *workers,
+		Categories:    strings.Split(*categories, ","),
+		Selection:     selection,
+		ReportFormats: strings.Split(*reportFormat, ","),
+		StartTime:     time.Now(),
+		Results:       make([]TestResult, 0),
+	}, nil
 }
 
 // ShouldRunTest determines if a test should be executed
@@ -237,6 +149,15 @@ func (tr *TestRunner) ShouldRunTest(suite TestSuite) bool {
 		}
 	}
 
+	if !tr.Selection.Matches(suite) {
+		return false
+	}
+
+	// Explicitly selected IDs and priority ranges replace the environment default
+	if len(tr.Selection.IDs) > 0 || tr.Selection.HasPriorityRange() {
+		return true
+	}
+
 	// Filter by environment
 	switch tr.Environment {
 	case "production":
@@ -248,7 +169,9 @@ func (tr *TestRunner) ShouldRunTest(suite TestSuite) bool {
 	}
 }
 
-// RunTest executes a single test
+// RunTest executes a single test suite. The test binary is re-executed with
+// only TestRegisteredSuite selected so that every suite runs in its own
+// process, from its own package directory, with its output captured.
 func (tr *TestRunner) RunTest(suite TestSuite) TestResult {
 	start := time.Now()
 
@@ -256,144 +179,403 @@ func (tr *TestRunner) RunTest(suite TestSuite) TestResult {
 		fmt.Printf("Running test: %s - %s\n", suite.Name, suite.Description)
 	}
 
-	// Here we would actually run the test
-	// For now, we'll simulate test execution
-	passed := true
-	var err error
-	output := fmt.Sprintf("Test %s completed successfully", suite.Name)
+	result := TestResult{TestSuite: suite, StartTime: start}
+	if suite.TestFunc == nil {
+		result.Error = fmt.Errorf("no test function registered")
+		return result
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		result.Error = fmt.Errorf("cannot locate test binary: %v", err)
+		return result
+	}
+
+	cmd := exec.Command(executable,
+		"-test.run=^TestRegisteredSuite$",
+		"-test.v",
+		"-test.timeout="+suiteTimeout.String())
+	cmd.Dir = suite.Dir
+	cmd.Env = childEnv(suiteEnvVar + "=" + suite.Name)
+	output, err := cmd.CombinedOutput()
+
+	result.Duration = time.Since(start)
+	result.Output = string(output)
+	result.Passed = err == nil
+	// Only the suite itself skipping counts, not one of its subtests
+	result.Skipped = result.Passed && strings.Contains(result.Output, "--- SKIP: TestRegisteredSuite (")
+	if err != nil {
+		result.Error = suiteFailure(result.Output, err)
+	}
+	return result
+}
+
+// RunTeardown re-executes the test binary to run a fixture teardown from its
+// package directory.
+func (tr *TestRunner) RunTeardown(teardown registry.Teardown) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate test binary: %v", err)
+	}
+
+	cmd := exec.Command(executable,
+		"-test.run=^TestRegisteredTeardown$",
+		"-test.v",
+		"-test.timeout="+suiteTimeout.String())
+	cmd.Dir = teardown.Dir
+	cmd.Env = childEnv(teardownEnvVar + "=" + teardown.Dir)
+	output, err := cmd.CombinedOutput()
+	if tr.Verbose {
+		fmt.Printf("Teardown of %s in %s:\n%s\n", teardown.Fixture, teardown.Dir, output)
+	}
+	if err != nil {
+		return fmt.Errorf("teardown of %s in %s: %v", teardown.Fixture, teardown.Dir, suiteFailure(string(output), err))
+	}
+	return nil
+}
+
+// fixturesEnabled reports whether suites may apply their fixtures. Fixtures
+// create real infrastructure, so that is opt-in; suites skip the checks
+// that need one otherwise.
+func fixturesEnabled() bool {
+	return *applyFixtures && !testing.Short()
+}
 
-	// Simulate some tests failing for demonstration
-	if strings.Contains(suite.Name, "SEC-002") {
-		passed = false
-		err = fmt.Errorf("simulated security test failure")
-		output = "Security test detected vulnerability"
+// childEnv returns the environment of a re-executed test binary: this
+// process's environment, the AWS settings from the flags, and extra.
+func childEnv(extra ...string) []string {
+	env := os.Environ()
+	if fixturesEnabled() {
+		env = append(env, awsenv.ApplyFixturesEnvVar+"=true")
 	}
+	if *awsRegion != "" {
+		env = append(env, awsenv.RegionEnvVar+"="+*awsRegion)
+	}
+	if *awsEndpoint != "" {
+		env = append(env, awsenv.EndpointEnvVar+"="+*awsEndpoint)
+	}
+	return append(env, extra...)
+}
 
-	duration := time.Since(start)
+// suiteFailure summarises a failed suite run using the first assertion or
+// log message reported by the test, falling back to the process error.
+func suiteFailure(output string, err error) error {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if message, found := strings.CutPrefix(line, "Error:"); found {
+			// testify continues multi-line messages on the following lines
+			// until the next "Test:" or "Messages:" field.
+			parts := []string{strings.TrimSpace(message)}
+			for _, next := range lines[i+1:] {
+				next = strings.TrimSpace(next)
+				if next == "" || strings.HasPrefix(next, "Test:") || strings.HasPrefix(next, "Messages:") {
+					break
+				}
+				parts = append(parts, next)
+			}
+			return fmt.Errorf("%s", strings.Join(parts, " "))
+		}
+		if strings.HasPrefix(line, "panic:") {
+			return fmt.Errorf("%s", line)
+		}
+	}
+	return err
+}
+
+// teardownAfter returns the fixture teardown to run after the suite at
+// position n of job: that of the suite's package, once no later suite of the
+// job is from the same package.
+func teardownAfter(suites []TestSuite, job []int, n int) (registry.Teardown, bool) {
+	suite := suites[job[n]]
+	if suite.Fixture == "" {
+		return registry.Teardown{}, false
+	}
+	for _, i := range job[n+1:] {
+		if suites[i].Dir == suite.Dir {
+			return registry.Teardown{}, false
+		}
+	}
+	for _, teardown := range registeredTeardowns {
+		if teardown.Fixture == suite.Fixture && teardown.Dir == suite.Dir {
+			return teardown, true
+		}
+	}
+	return registry.Teardown{}, false
+}
 
-	return TestResult{
-		TestSuite: suite,
-		Passed:    passed,
-		Duration:  duration,
-		Error:     err,
-		Output:    output,
+// findSuite looks up a registered test suite by name.
+func findSuite(name string) (TestSuite, bool) {
+	for _, suite := range testSuites {
+		if suite.Name == name {
+			return suite, true
+		}
 	}
+	return TestSuite{}, false
 }
 
-// RunAllTests executes all applicable tests
-func (tr *TestRunner) RunAllTests() {
+// RunAllTests executes all applicable tests. With Parallel set, suites run
+// on a pool of Workers goroutines; suites sharing a fixture still run one
+// after another, and a package's teardown of the fixture runs after the last
+// of its suites. Results are reported in registry order either way. It
+// returns an error when a report could not be written.
+func (tr *TestRunner) RunAllTests() error {
+	workers := 1
+	if tr.Parallel && tr.Workers > 1 {
+		workers = tr.Workers
+	}
+
 	fmt.Printf("Starting Aegis Test Suite\n")
 	fmt.Printf("Environment: %s\n", tr.Environment)
 	fmt.Printf("Categories: %v\n", tr.Categories)
-	fmt.Printf("Parallel: %v\n", tr.Parallel)
+	fmt.Printf("Parallel: %v (%d workers)\n", tr.Parallel, workers)
 	fmt.Printf("Report Directory: %s\n", tr.ReportDir)
 	fmt.Println(strings.Repeat("=", 50))
 
+	var selected []TestSuite
 	for _, suite := range testSuites {
 		if tr.ShouldRunTest(suite) {
-			result := tr.RunTest(suite)
-			tr.Results = append(tr.Results, result)
+			selected = append(selected, suite)
+		}
+	}
 
-			status := "PASS"
-			if !result.Passed {
-				status = "FAIL"
+	results := make([]TestResult, len(selected))
+	var printMu sync.Mutex
+	jobs := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				for n, i := range job {
+					results[i] = tr.RunTest(selected[i])
+
+					printMu.Lock()
+					tr.printResult(results[i])
+					printMu.Unlock()
+
+					teardown, ok := teardownAfter(selected, job, n)
+					if !ok || !fixturesEnabled() {
+						continue
+					}
+					if err := tr.RunTeardown(teardown); err != nil {
+						printMu.Lock()
+						fmt.Printf("Error: %v\n", err)
+						tr.Teardowns = append(tr.Teardowns, err)
+						printMu.Unlock()
+					}
+				}
 			}
+		}()
+	}
+	for _, job := range scheduleSuites(selected) {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
 
-			fmt.Printf("%-15s %-50s %s (%.2fs)\n",
-				suite.Name, suite.Description, status, result.Duration.Seconds())
-
-			if !result.Passed && result.Error != nil {
-				fmt.Printf("  Error: %v\n", result.Error)
-			}
+	tr.Results = append(tr.Results, results...)
+	tr.EndTime = time.Now()
+	return tr.GenerateReport()
+}
 
-			if tr.Verbose && result.Output != "" {
-				fmt.Printf("  Output: %s\n", result.Output)
-			}
+// PolicyViolations returns the reasons the run should fail: a failed suite
+// with priority at or above failOnPriority (lower numbers are more critical;
+// 0 disables the check), or a success rate below minSuccessRate percent. The
+// success rate is over the suites that ran, unless skipsFail counts skipped
+// suites as failed; a minimum rate is never met when every suite skipped.
+func (tr *TestRunner) PolicyViolations(failOnPriority int, minSuccessRate float64, skipsFail bool) []string {
+	var violations []string
+	for _, result := range tr.Results {
+		if !result.Passed && result.TestSuite.Priority <= failOnPriority {
+			violations = append(violations, fmt.Sprintf("%s (priority %d) failed",
+				result.TestSuite.Name, result.TestSuite.Priority))
 		}
 	}
 
-	tr.EndTime = time.Now()
-	tr.GenerateReport()
+	stats := summarize(tr.Results)
+	if stats.Total == 0 || minSuccessRate <= 0 {
+		return violations
+	}
+	successRate, ran := stats.SuccessRate()
+	if skipsFail {
+		successRate, ran = float64(stats.Passed)/float64(stats.Total)*100, true
+	}
+	switch {
+	case !ran:
+		violations = append(violations, fmt.Sprintf("all %d suites skipped, so the required success rate of %.1f%% is not met",
+			stats.Total, minSuccessRate))
+	case successRate < minSuccessRate:
+		violations = append(violations, fmt.Sprintf("success rate %.1f%% is below the required %.1f%%",
+			successRate, minSuccessRate))
+	}
+	return violations
 }
 
-// GenerateReport creates a comprehensive test report
-func (tr *TestRunner) GenerateReport() {
-	// Create report directory
-	os.MkdirAll(tr.ReportDir, 0755)
+// scheduleSuites groups suites into jobs of indexes into suites. Suites that
+// share a fixture form a single job so that they run sequentially; every
+// other suite is a job of its own.
+func scheduleSuites(suites []TestSuite) [][]int {
+	var jobs [][]int
+	fixtureJobs := make(map[string]int)
+	for i, suite := range suites {
+		if suite.Fixture == "" {
+			jobs = append(jobs, []int{i})
+			continue
+		}
+		if j, ok := fixtureJobs[suite.Fixture]; ok {
+			jobs[j] = append(jobs[j], i)
+			continue
+		}
+		fixtureJobs[suite.Fixture] = len(jobs)
+		jobs = append(jobs, []int{i})
+	}
+	return jobs
+}
 
-	// Calculate statistics
-	totalTests := len(tr.Results)
-	passedTests := 0
-	failedTests := 0
-	totalDuration := time.Duration(0)
+func (tr *TestRunner) printResult(result TestResult) {
+	fmt.Printf("%-15s %-50s %s (%.2fs)\n",
+		result.TestSuite.Name, result.TestSuite.Description, result.Status(), result.Duration.Seconds())
 
-	for _, result := range tr.Results {
-		if result.Passed {
-			passedTests++
-		} else {
-			failedTests++
-		}
-		totalDuration += result.Duration
+	if !result.Passed && result.Error != nil {
+		fmt.Printf("  Error: %v\n", result.Error)
 	}
 
-	// Generate summary report
-	reportPath := filepath.Join(tr.ReportDir, "test-summary.txt")
-	report, err := os.Create(reportPath)
-	if err != nil {
-		fmt.Printf("Error creating report: %v\n", err)
-		return
-	}
-	defer report.Close()
-
-	fmt.Fprintf(report, "Aegis Kubernetes Framework - Test Report\n")
-	fmt.Fprintf(report, "Generated: %s\n", time.Now().Format(time.RFC3339))
-	fmt.Fprintf(report, "Environment: %s\n", tr.Environment)
-	fmt.Fprintf(report, "Duration: %v\n", tr.EndTime.Sub(tr.StartTime))
-	fmt.Fprintf(report, "\n")
-	fmt.Fprintf(report, "Test Summary:\n")
-	fmt.Fprintf(report, "Total Tests: %d\n", totalTests)
-	fmt.Fprintf(report, "Passed: %d\n", passedTests)
-	fmt.Fprintf(report, "Failed: %d\n", failedTests)
-	fmt.Fprintf(report, "Success Rate: %.1f%%\n", float64(passedTests)/float64(totalTests)*100)
-	fmt.Fprintf(report, "Average Duration: %v\n", totalDuration/time.Duration(totalTests))
-	fmt.Fprintf(report, "\n")
-
-	// Generate detailed results
-	fmt.Fprintf(report, "Detailed Results:\n")
-	fmt.Fprintf(report, "%-15s %-10s %-10s %-s\n", "Test ID", "Status", "Duration", "Description")
-	fmt.Fprintf(report, strings.Repeat("-", 80) + "\n")
+	if tr.Verbose && result.Output != "" {
+		fmt.Printf("  Output: %s\n", result.Output)
+	}
+}
 
-	for _, result := range tr.Results {
-		status := "PASS"
-		if !result.Passed {
-			status = "FAIL"
-		}
+// GenerateReport writes a report in each of the selected formats. Reports
+// are replaced atomically, so a failed run never leaves a truncated report
+// behind; every format is attempted even when an earlier one fails.
+func (tr *TestRunner) GenerateReport() error {
+	if err := os.MkdirAll(tr.ReportDir, 0755); err != nil {
+		return fmt.Errorf("creating report directory: %w", err)
+	}
 
-		fmt.Fprintf(report, "%-15s %-10s %-10s %-s\n",
-			result.TestSuite.Name,
-			status,
-			fmt.Sprintf("%.2fs", result.Duration.Seconds()),
-			result.TestSuite.Description)
+	var errs []error
+	for _, format := range tr.ReportFormats {
+		reporter := reporters[format]
 
-		if !result.Passed && result.Error != nil {
-			fmt.Fprintf(report, "  Error: %v\n", result.Error)
+		var report bytes.Buffer
+		if err := reporter.Write(&report, tr); err != nil {
+			errs = append(errs, fmt.Errorf("rendering %s report: %w", format, err))
+			continue
 		}
+		reportPath := filepath.Join(tr.ReportDir, reporter.FileName())
+		if err := writeFileAtomic(reportPath, report.Bytes()); err != nil {
+			errs = append(errs, fmt.Errorf("writing %s report: %w", format, err))
+			continue
+		}
+
+		fmt.Printf("\nTest Report Generated: %s\n", reportPath)
 	}
 
-	fmt.Printf("\nTest Report Generated: %s\n", reportPath)
-	fmt.Printf("Summary: %d/%d tests passed (%.1f%%)\n",
-		passedTests, totalTests, float64(passedTests)/float64(totalTests)*100)
+	stats := summarize(tr.Results)
+	successRate, ran := stats.SuccessRate()
+	switch {
+	case stats.Total == 0:
+		fmt.Printf("Summary: no tests were run\n")
+	case !ran:
+		fmt.Printf("Summary: all %d tests skipped\n", stats.Total)
+	default:
+		fmt.Printf("Summary: %d/%d tests passed (%.1f%%), %d skipped\n",
+			stats.Passed, stats.Ran(), successRate, stats.Skipped)
+	}
+	return errors.Join(errs...)
 }
 
 // Main test function
 func TestMain(m *testing.M) {
 	flag.Parse()
 
-	runner := NewTestRunner()
-	runner.RunAllTests()
+	if err := registry.Validate(testSuites); err != nil {
+		fmt.Printf("Error: invalid test registry:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	if err := validateReportFormats(strings.Split(*reportFormat, ",")); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// A re-executed binary runs a single suite through TestRegisteredSuite,
+	// or a fixture teardown through TestRegisteredTeardown.
+	if os.Getenv(suiteEnvVar) != "" || os.Getenv(teardownEnvVar) != "" {
+		os.Exit(m.Run())
+	}
+
+	runner, err := NewTestRunner()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *list {
+		runner.ListTests()
+		os.Exit(0)
+	}
 
-	// Exit with appropriate code based on test results
-	os.Exit(0) // For now, always exit 0
+	reportErr := runner.RunAllTests()
+	if reportErr != nil {
+		fmt.Printf("Error: %v\n", reportErr)
+	}
+
+	if *recordHistory {
+		if err := runner.RecordHistory(); err != nil {
+			fmt.Printf("Error recording test history: %v\n", err)
+		}
+	}
+
+	// Run the standard Go tests in this package as well
+	code := m.Run()
+
+	violations := runner.PolicyViolations(*failOnPriority, *minSuccessRate, *skipsFail)
+	for _, violation := range violations {
+		fmt.Printf("FAIL: %s\n", violation)
+	}
+	for _, err := range runner.Teardowns {
+		fmt.Printf("FAIL: %v\n", err)
+	}
+	if code == 0 && (len(violations) > 0 || len(runner.Teardowns) > 0 || reportErr != nil) {
+		code = 1
+	}
+	os.Exit(code)
+}
+
+// TestRegisteredSuite runs the suite named by AEGIS_TEST_SUITE. It is only
+// selected when the runner re-executes the test binary for a suite.
+func TestRegisteredSuite(t *testing.T) {
+	name := os.Getenv(suiteEnvVar)
+	if name == "" {
+		t.Skip(suiteEnvVar + " is not set")
+	}
+
+	suite, ok := findSuite(name)
+	if !ok || suite.TestFunc == nil {
+		t.Fatalf("no test function registered for %s", name)
+	}
+	suite.TestFunc(t)
+}
+
+// TestRegisteredTeardown runs the fixture teardown of the package directory
+// named by AEGIS_TEST_TEARDOWN. It is only selected when the runner
+// re-executes the test binary for a teardown.
+func TestRegisteredTeardown(t *testing.T) {
+	dir := os.Getenv(teardownEnvVar)
+	if dir == "" {
+		t.Skip(teardownEnvVar + " is not set")
+	}
+
+	for _, teardown := range registeredTeardowns {
+		if teardown.Dir == dir && teardown.Func != nil {
+			teardown.Func(t)
+			return
+		}
+	}
+	t.Fatalf("no teardown registered for %s", dir)
 }
 
 // Example unit test
@@ -436,4 +618,4 @@ func TestComplianceExample(t *testing.T) {
 	// Example compliance test
 	// This would test regulatory compliance
 	assert.True(true, "Compliance test placeholder")
-}
\ No newline at end of file
+}
@@ -0,0 +1,9 @@
+package registry
+
+// Compliance controls referenced by the test suites
+var (
+	CISAWS31      = Control{Framework: "CIS AWS Foundations", ControlID: "3.1"}
+	NISTCSFPRAC5  = Control{Framework: "NIST CSF", ControlID: "PR.AC-5"}
+	ISO27001A1311 = Control{Framework: "ISO 27001", ControlID: "A.13.1.1"}
+	SOC2CC61      = Control{Framework: "SOC 2", ControlID: "CC6.1"}
+)
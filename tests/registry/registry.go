@@ -0,0 +1,212 @@
+// Aegis Test Registry
+// Test packages register their suites next to the test functions; the
+// runner in tests/main_test.go builds its registry from them
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// modulePath is the import path prefix of file names compiled with -trimpath
+const modulePath = "aegis-kubernetes-framework/tests/"
+
+// Control identifies a control in a compliance framework
+type Control struct {
+	Framework string `json:"framework"`
+	ControlID string `json:"controlId"`
+}
+
+func (c Control) String() string {
+	return c.Framework + " " + c.ControlID
+}
+
+// Tags describing the kind of test a suite is
+const (
+	TagUnit        = "unit"
+	TagIntegration = "integration"
+	TagSecurity    = "security"
+	TagCompliance  = "compliance"
+)
+
+// Suite describes a registered test suite
+type Suite struct {
+	Name        string
+	Description string
+	TestFunc    func(t *testing.T)
+	Category    string
+	Priority    int       // 1=Critical, 2=High, 3=Medium, 4=Low
+	Tags        []string  // Kind of test: TagUnit, TagIntegration, TagSecurity or TagCompliance
+	Dir         string    // Package directory the test runs in; set by Register
+	Controls    []Control // Compliance controls the suite provides evidence for
+	Fixture     string    // Shared fixture; suites with the same fixture never run concurrently
+}
+
+var registered []Suite
+
+// Register adds a suite to the registry. Call it from a package-level
+// declaration directly above the test function:
+//
+//	var _ = registry.Register(registry.Suite{
+//		Name:     "VPC-UNIT-001",
+//		TestFunc: TestVPCCIDRCalculations,
+//		...
+//	})
+func Register(suite Suite) bool {
+	if suite.Dir == "" {
+		suite.Dir = callerDir()
+	}
+	registered = append(registered, suite)
+	return true
+}
+
+// callerDir returns the package directory of the caller of the registering
+// function
+func callerDir() string {
+	_, file, _, _ := runtime.Caller(2)
+	if relative, found := strings.CutPrefix(file, modulePath); found {
+		file = relative
+	}
+	return filepath.Dir(file)
+}
+
+// Teardown releases a fixture the suites of a package share. The runner
+// runs it from the package directory once every selected suite of the
+// fixture has run.
+type Teardown struct {
+	Fixture string
+	Func    func(t *testing.T)
+	Dir     string // Package directory the teardown runs in; set by RegisterTeardown
+}
+
+var teardowns []Teardown
+
+// RegisterTeardown adds the teardown of a package's fixture to the registry;
+// a package registers at most one
+func RegisterTeardown(teardown Teardown) bool {
+	if teardown.Dir == "" {
+		teardown.Dir = callerDir()
+	}
+	teardowns = append(teardowns, teardown)
+	return true
+}
+
+// Teardowns returns all registered teardowns in registration order
+func Teardowns() []Teardown {
+	return append([]Teardown(nil), teardowns...)
+}
+
+// Suites returns all registered suites ordered by name
+func Suites() []Suite {
+	suites := append([]Suite(nil), registered...)
+	sort.SliceStable(suites, func(i, j int) bool {
+		return suites[i].Name < suites[j].Name
+	})
+	return suites
+}
+
+// Validate reports duplicate suite IDs, suites without a test function and
+// orphaned test functions: Test* functions in a registered package that no
+// suite refers to.
+func Validate(suites []Suite) error {
+	var errs []error
+
+	names := make(map[string]bool)
+	funcs := make(map[string]string) // package directory + function name -> suite
+	for _, suite := range suites {
+		if names[suite.Name] {
+			errs = append(errs, fmt.Errorf("duplicate suite ID %s", suite.Name))
+		}
+		names[suite.Name] = true
+
+		if suite.TestFunc == nil {
+			errs = append(errs, fmt.Errorf("suite %s has no test function", suite.Name))
+			continue
+		}
+		key := filepath.Join(suite.Dir, funcName(suite.TestFunc))
+		if other, ok := funcs[key]; ok {
+			errs = append(errs, fmt.Errorf("suites %s and %s register the same function %s",
+				other, suite.Name, funcName(suite.TestFunc)))
+		}
+		funcs[key] = suite.Name
+	}
+
+	dirs := make(map[string]bool)
+	for _, suite := range suites {
+		dirs[suite.Dir] = true
+	}
+	for dir := range dirs {
+		tests, err := testFunctions(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, name := range tests {
+			if _, ok := funcs[filepath.Join(dir, name)]; !ok {
+				errs = append(errs, fmt.Errorf("orphaned test function %s in %s has no registered suite", name, dir))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func funcName(fn func(t *testing.T)) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// testFunctions returns the names of the func TestXxx(t *testing.T)
+// functions declared in the non-test Go files of dir
+func testFunctions(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range parsed.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Recv == nil && strings.HasPrefix(fn.Name.Name, "Test") && takesTestingT(fn) {
+				names = append(names, fn.Name.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func takesTestingT(fn *ast.FuncDecl) bool {
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	selector, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := selector.X.(*ast.Ident)
+	return ok && pkg.Name == "testing" && selector.Sel.Name == "T"
+}
@@ -0,0 +1,421 @@
+// Aegis Kubernetes Framework - Test Reporters
+// Output formats for test run results, selected with -report-format
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"aegis-kubernetes-framework/tests/registry"
+)
+
+// Reporter renders the results of a test run in one output format
+type Reporter interface {
+	// FileName is the name of the report file within the report directory
+	FileName() string
+	// Write renders the results of the runner to w
+	Write(w io.Writer, tr *TestRunner) error
+}
+
+// reporters maps -report-format values to their implementations
+var reporters = map[string]Reporter{
+	"text":     textReporter{},
+	"junit":    junitReporter{},
+	"json":     jsonReporter{},
+	"markdown": markdownReporter{},
+	"html":     htmlReporter{},
+
+	"compliance-json": complianceJSONReporter{},
+	"compliance-csv":  complianceCSVReporter{},
+}
+
+// validateReportFormats checks that every requested format has a reporter
+func validateReportFormats(formats []string) error {
+	for _, format := range formats {
+		if _, ok := reporters[format]; !ok {
+			names := make([]string, 0, len(reporters))
+			for name := range reporters {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown report format %q (available: %s)", format, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data by writing a temporary file in the
+// same directory and renaming it over path
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runSummary holds the aggregate statistics of a test run
+type runSummary struct {
+	Total    int
+	Passed   int
+	Failed   int
+	Skipped  int
+	Duration time.Duration
+}
+
+// Ran returns the number of suites that ran rather than skipped.
+func (s runSummary) Ran() int {
+	return s.Total - s.Skipped
+}
+
+// SuccessRate returns the percentage of the suites that ran which passed,
+// and false when every suite skipped.
+func (s runSummary) SuccessRate() (float64, bool) {
+	if s.Ran() == 0 {
+		return 0, false
+	}
+	return float64(s.Passed) / float64(s.Ran()) * 100, true
+}
+
+// summarize counts each result once: skipped suites are neither passed nor
+// failed.
+func summarize(results []TestResult) runSummary {
+	var stats runSummary
+	for _, result := range results {
+		stats.Total++
+		switch {
+		case !result.Passed:
+			stats.Failed++
+		case result.Skipped:
+			stats.Skipped++
+		default:
+			stats.Passed++
+		}
+		stats.Duration += result.Duration
+	}
+	return stats
+}
+
+// textReporter writes the plain text summary report
+type textReporter struct{}
+
+func (textReporter) FileName() string { return "test-summary.txt" }
+
+func (textReporter) Write(report io.Writer, tr *TestRunner) error {
+	stats := summarize(tr.Results)
+
+	fmt.Fprintf(report, "Aegis Kubernetes Framework - Test Report\n")
+	fmt.Fprintf(report, "Generated: %s\n", tr.EndTime.Format(time.RFC3339))
+	fmt.Fprintf(report, "Environment: %s\n", tr.Environment)
+	fmt.Fprintf(report, "Duration: %v\n", tr.EndTime.Sub(tr.StartTime))
+	fmt.Fprintf(report, "\n")
+	fmt.Fprintf(report, "Test Summary:\n")
+	fmt.Fprintf(report, "Total Tests: %d\n", stats.Total)
+	fmt.Fprintf(report, "Passed: %d\n", stats.Passed)
+	fmt.Fprintf(report, "Failed: %d\n", stats.Failed)
+	fmt.Fprintf(report, "Skipped: %d\n", stats.Skipped)
+	if stats.Total == 0 {
+		fmt.Fprintf(report, "Success Rate: n/a\n")
+		fmt.Fprintf(report, "Average Duration: n/a\n")
+		fmt.Fprintf(report, "\nNo tests were run: no suite matched the selection.\n")
+		return nil
+	}
+	if successRate, ok := stats.SuccessRate(); ok {
+		fmt.Fprintf(report, "Success Rate: %.1f%%\n", successRate)
+	} else {
+		fmt.Fprintf(report, "Success Rate: n/a\n")
+	}
+	fmt.Fprintf(report, "Average Duration: %v\n", stats.Duration/time.Duration(stats.Total))
+	fmt.Fprintf(report, "\n")
+
+	// Generate detailed results
+	fmt.Fprintf(report, "Detailed Results:\n")
+	fmt.Fprintf(report, "%-15s %-10s %-10s %-s\n", "Test ID", "Status", "Duration", "Description")
+	fmt.Fprintln(report, strings.Repeat("-", 80))
+
+	for _, result := range tr.Results {
+		fmt.Fprintf(report, "%-15s %-10s %-10s %-s\n",
+			result.TestSuite.Name,
+			result.Status(),
+			fmt.Sprintf("%.2fs", result.Duration.Seconds()),
+			result.TestSuite.Description)
+
+		if !result.Passed && result.Error != nil {
+			fmt.Fprintf(report, "  Error: %v\n", result.Error)
+		}
+	}
+	return nil
+}
+
+// junitReporter writes JUnit XML with one <testsuite> per category
+type junitReporter struct{}
+
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitFailure   `xml:"failure,omitempty"`
+	Skipped    *struct{}       `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func (junitReporter) FileName() string { return "junit.xml" }
+
+func (junitReporter) Write(w io.Writer, tr *TestRunner) error {
+	stats := summarize(tr.Results)
+	root := junitTestSuites{
+		Name:     "aegis",
+		Tests:    stats.Total,
+		Failures: stats.Failed,
+		Skipped:  stats.Skipped,
+		Time:     junitSeconds(tr.EndTime.Sub(tr.StartTime)),
+	}
+
+	suiteIndex := make(map[string]int)
+	var suiteDurations []time.Duration
+	for _, result := range tr.Results {
+		category := result.TestSuite.Category
+		index, ok := suiteIndex[category]
+		if !ok {
+			index = len(root.TestSuites)
+			suiteIndex[category] = index
+			root.TestSuites = append(root.TestSuites, junitTestSuite{
+				Name:      category,
+				Timestamp: tr.StartTime.Format(time.RFC3339),
+			})
+			suiteDurations = append(suiteDurations, 0)
+		}
+		suite := &root.TestSuites[index]
+
+		testCase := junitTestCase{
+			Name:      result.TestSuite.Name,
+			ClassName: "aegis." + category,
+			Time:      junitSeconds(result.Duration),
+			Properties: []junitProperty{
+				{Name: "description", Value: result.TestSuite.Description},
+				{Name: "priority", Value: fmt.Sprintf("%d", result.TestSuite.Priority)},
+			},
+			SystemOut: result.Output,
+		}
+		for _, control := range result.TestSuite.Controls {
+			testCase.Properties = append(testCase.Properties, junitProperty{Name: "compliance", Value: control.String()})
+		}
+
+		suite.Tests++
+		suiteDurations[index] += result.Duration
+		suite.Time = junitSeconds(suiteDurations[index])
+		switch {
+		case !result.Passed:
+			suite.Failures++
+			message := "test failed"
+			if result.Error != nil {
+				message = result.Error.Error()
+			}
+			testCase.Failure = &junitFailure{Message: message, Body: result.Output}
+			testCase.SystemOut = ""
+		case result.Skipped:
+			suite.Skipped++
+			testCase.Skipped = &struct{}{}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// jsonReporter writes machine-readable results
+type jsonReporter struct{}
+
+type jsonReport struct {
+	Environment string       `json:"environment"`
+	StartTime   time.Time    `json:"startTime"`
+	EndTime     time.Time    `json:"endTime"`
+	Duration    float64      `json:"durationSeconds"`
+	Summary     jsonSummary  `json:"summary"`
+	Results     []jsonResult `json:"results"`
+}
+
+type jsonSummary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+type jsonResult struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Category    string             `json:"category"`
+	Priority    int                `json:"priority"`
+	Compliance  []registry.Control `json:"compliance"`
+	Status      string             `json:"status"`
+	Duration    float64            `json:"durationSeconds"`
+	Error       string             `json:"error,omitempty"`
+	Output      string             `json:"output"`
+}
+
+func (jsonReporter) FileName() string { return "test-results.json" }
+
+func (jsonReporter) Write(w io.Writer, tr *TestRunner) error {
+	stats := summarize(tr.Results)
+	report := jsonReport{
+		Environment: tr.Environment,
+		StartTime:   tr.StartTime,
+		EndTime:     tr.EndTime,
+		Duration:    tr.EndTime.Sub(tr.StartTime).Seconds(),
+		Summary: jsonSummary{
+			Total:   stats.Total,
+			Passed:  stats.Passed,
+			Failed:  stats.Failed,
+			Skipped: stats.Skipped,
+		},
+		Results: make([]jsonResult, 0, len(tr.Results)),
+	}
+
+	for _, result := range tr.Results {
+		entry := jsonResult{
+			Name:        result.TestSuite.Name,
+			Description: result.TestSuite.Description,
+			Category:    result.TestSuite.Category,
+			Priority:    result.TestSuite.Priority,
+			Compliance:  result.TestSuite.Controls,
+			Status:      result.Status(),
+			Duration:    result.Duration.Seconds(),
+			Output:      result.Output,
+		}
+		if entry.Compliance == nil {
+			entry.Compliance = []registry.Control{}
+		}
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+		}
+		report.Results = append(report.Results, entry)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// markdownReporter writes a summary suitable for pull request comments
+type markdownReporter struct{}
+
+func (markdownReporter) FileName() string { return "test-summary.md" }
+
+func (markdownReporter) Write(w io.Writer, tr *TestRunner) error {
+	stats := summarize(tr.Results)
+
+	fmt.Fprintf(w, "# Aegis Test Report\n\n")
+	fmt.Fprintf(w, "- **Environment:** %s\n", tr.Environment)
+	fmt.Fprintf(w, "- **Duration:** %v\n", tr.EndTime.Sub(tr.StartTime).Round(time.Millisecond))
+	fmt.Fprintf(w, "- **Result:** %d passed, %d failed, %d skipped (%d total)\n\n",
+		stats.Passed, stats.Failed, stats.Skipped, stats.Total)
+
+	if stats.Total == 0 {
+		fmt.Fprintf(w, "No tests were run: no suite matched the selection.\n")
+		return nil
+	}
+
+	fmt.Fprintf(w, "| Test ID | Status | Priority | Duration | Description |\n")
+	fmt.Fprintf(w, "|---------|--------|----------|----------|-------------|\n")
+	for _, result := range tr.Results {
+		fmt.Fprintf(w, "| %s | %s | %d | %.2fs | %s |\n",
+			result.TestSuite.Name,
+			result.Status(),
+			result.TestSuite.Priority,
+			result.Duration.Seconds(),
+			markdownEscape(result.TestSuite.Description))
+	}
+
+	if stats.Failed == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\n## Failures\n")
+	for _, result := range tr.Results {
+		if result.Passed {
+			continue
+		}
+		fmt.Fprintf(w, "\n### %s: %s\n\n", result.TestSuite.Name, result.TestSuite.Description)
+		if result.Error != nil {
+			fmt.Fprintf(w, "**Error:** %s\n\n", markdownEscape(result.Error.Error()))
+		}
+		if result.Output != "" {
+			fmt.Fprintf(w, "<details><summary>Output</summary>\n\n```\n%s\n```\n\n</details>\n",
+				strings.TrimRight(result.Output, "\n"))
+		}
+	}
+	return nil
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
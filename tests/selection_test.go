@@ -0,0 +1,135 @@
+// Aegis Kubernetes Framework - Test Selection
+// Selects suites by ID, name pattern, tag and priority range
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Selection narrows down the suites of a run. Empty fields select all suites.
+type Selection struct {
+	IDs         []string       // Only these suite IDs
+	Exclude     []string       // Never these suite IDs
+	Match       *regexp.Regexp // Suite IDs matching this pattern
+	Tags        []string       // Suites with at least one of these tags
+	MinPriority int            // Priority range, inclusive; 0 means unbounded
+	MaxPriority int
+}
+
+// parseSelection builds a Selection from the command line values, rejecting
+// suite IDs that are not registered.
+func parseSelection(ids, exclude, match, tags, priority string) (Selection, error) {
+	selection := Selection{
+		IDs:     splitList(ids),
+		Exclude: splitList(exclude),
+		Tags:    splitList(tags),
+	}
+
+	for _, id := range append(append([]string(nil), selection.IDs...), selection.Exclude...) {
+		if _, ok := findSuite(id); !ok {
+			return selection, fmt.Errorf("unknown suite ID %s", id)
+		}
+	}
+
+	if match != "" {
+		pattern, err := regexp.Compile(match)
+		if err != nil {
+			return selection, fmt.Errorf("invalid -match pattern: %v", err)
+		}
+		selection.Match = pattern
+	}
+
+	var err error
+	selection.MinPriority, selection.MaxPriority, err = parsePriorityRange(priority)
+	return selection, err
+}
+
+// parsePriorityRange parses "2", "1-2", "2-" or "-3"
+func parsePriorityRange(value string) (int, int, error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+
+	low, high, isRange := strings.Cut(value, "-")
+	if !isRange {
+		high = low
+	}
+
+	bounds := [2]int{}
+	for i, bound := range []string{low, high} {
+		if bound == "" {
+			continue
+		}
+		priority, err := strconv.Atoi(bound)
+		if err != nil || priority < 1 || priority > 4 {
+			return 0, 0, fmt.Errorf("invalid -priority %q: priorities range from 1 (critical) to 4 (low)", value)
+		}
+		bounds[i] = priority
+	}
+	if bounds[1] == 0 {
+		bounds[1] = 4
+	}
+	if bounds[0] > bounds[1] {
+		return 0, 0, fmt.Errorf("invalid -priority %q: range is reversed", value)
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// HasPriorityRange reports whether an explicit priority range was selected
+func (s Selection) HasPriorityRange() bool {
+	return s.MaxPriority > 0
+}
+
+// Matches reports whether the suite is selected
+func (s Selection) Matches(suite TestSuite) bool {
+	if len(s.IDs) > 0 && !slices.Contains(s.IDs, suite.Name) {
+		return false
+	}
+	if slices.Contains(s.Exclude, suite.Name) {
+		return false
+	}
+	if s.Match != nil && !s.Match.MatchString(suite.Name) {
+		return false
+	}
+	if len(s.Tags) > 0 && !slices.ContainsFunc(suite.Tags, func(tag string) bool {
+		return slices.Contains(s.Tags, tag)
+	}) {
+		return false
+	}
+	if s.HasPriorityRange() && (suite.Priority < s.MinPriority || suite.Priority > s.MaxPriority) {
+		return false
+	}
+	return true
+}
+
+// ListTests prints the suites that would run without running them
+func (tr *TestRunner) ListTests() {
+	fmt.Printf("%-17s %-10s %-8s %-24s %s\n", "Test ID", "Category", "Priority", "Tags", "Description")
+	fmt.Println(strings.Repeat("-", 80))
+
+	count := 0
+	for _, suite := range testSuites {
+		if !tr.ShouldRunTest(suite) {
+			continue
+		}
+		fmt.Printf("%-17s %-10s %-8d %-24s %s\n",
+			suite.Name, suite.Category, suite.Priority, strings.Join(suite.Tags, ","), suite.Description)
+		count++
+	}
+	fmt.Printf("\n%d of %d suites selected\n", count, len(testSuites))
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -5,74 +5,84 @@ package vpc
 
 import (
 	"testing"
+
 	"github.com/gruntwork-io/terratest/modules/terraform"
-	"github.com/gruntwork-io/terratest/modules/aws"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aegis-kubernetes-framework/tests/awsenv"
+	"aegis-kubernetes-framework/tests/registry"
+	"aegis-kubernetes-framework/tests/vpc/vpctest"
 )
 
-// TestVPC-COMP-001: CIS AWS Foundations Benchmark 3.1
+var _ = registry.RegisterTeardown(registry.Teardown{Fixture: vpctest.Fixture, Func: vpctest.Teardown})
+
+var _ = registry.Register(registry.Suite{
+	Name:        "VPC-COMP-001",
+	Description: "CIS AWS Foundations Benchmark 3.1",
+	Category:    "vpc",
+	Priority:    1,
+	Tags:        []string{registry.TagCompliance},
+	Controls:    []registry.Control{registry.CISAWS31},
+	Fixture:     vpctest.Fixture,
+	TestFunc:    TestCISBenchmark31,
+})
+
 func TestCISBenchmark31(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../terraform/modules/vpc",
-		Vars: map[string]interface{}{
-			"vpc_cidr":           "10.0.0.0/16",
-			"availability_zones": []string{"us-east-1a", "us-east-1b"},
-			"public_subnets":     []string{"10.0.1.0/24", "10.0.2.0/24"},
-			"private_subnets":    []string{"10.0.10.0/24", "10.0.11.0/24"},
-			"environment":        "test",
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	terraformOptions := vpctest.Apply(t, vpctest.TwoZones)
 
 	vpcId := terraform.Output(t, terraformOptions, "vpc_id")
 
 	// CIS 3.1: Ensure that VPCs have corresponding flow logs
-	flowLogs := aws.GetVpcFlowLogs(t, vpcId, "us-east-1")
+	flowLogs := vpctest.GetVpcFlowLogs(t, vpcId)
 	assert.NotEmpty(t, flowLogs, "CIS 3.1: VPC must have flow logs enabled")
 
 	// Verify flow logs are configured correctly
 	for _, flowLog := range flowLogs {
-		assert.Equal(t, "ACTIVE", *flowLog.FlowLogStatus,
-			"CIS 3.1: Flow logs must be active")
 		assert.NotEmpty(t, flowLog.LogDestination,
 			"CIS 3.1: Flow logs must have a destination")
 	}
+
+	t.Run("Delivery", func(t *testing.T) {
+		awsenv.SkipOnEmulator(t, "the emulator stores flow logs but never captures or delivers traffic, so their status does not show delivery works")
+
+		for _, flowLog := range flowLogs {
+			assert.Equal(t, "ACTIVE", *flowLog.FlowLogStatus,
+				"CIS 3.1: Flow logs must be active")
+		}
+	})
 }
 
-// TestVPC-COMP-002: NIST Cybersecurity Framework PR.AC-5
+var _ = registry.Register(registry.Suite{
+	Name:        "VPC-COMP-002",
+	Description: "NIST Cybersecurity Framework PR.AC-5",
+	Category:    "vpc",
+	Priority:    1,
+	Tags:        []string{registry.TagCompliance},
+	Controls:    []registry.Control{registry.NISTCSFPRAC5},
+	Fixture:     vpctest.Fixture,
+	TestFunc:    TestNISTCSFPRAC5,
+})
+
 func TestNISTCSFPRAC5(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../terraform/modules/vpc",
-		Vars: map[string]interface{}{
-			"vpc_cidr":           "10.0.0.0/16",
-			"availability_zones": []string{"us-east-1a", "us-east-1b"},
-			"public_subnets":     []string{"10.0.1.0/24", "10.0.2.0/24"},
-			"private_subnets":    []string{"10.0.10.0/24", "10.0.11.0/24"},
-			"environment":        "test",
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	terraformOptions := vpctest.Apply(t, vpctest.TwoZones)
 
 	vpcId := terraform.Output(t, terraformOptions, "vpc_id")
 
 	// NIST PR.AC-5: Network access to network interfaces should be restricted
-	subnets := aws.GetSubnetsByVpcId(t, vpcId, "us-east-1")
+	subnets := vpctest.GetSubnetsByVpcId(t, vpcId)
 
 	for _, subnet := range subnets {
 		// Verify subnet has network ACL
-		assert.NotEmpty(t, subnet.NetworkAclId,
+		nacl := vpctest.GetNetworkAclForSubnet(t, *subnet.SubnetId)
+		require.NotNil(t, nacl,
 			"NIST PR.AC-5: All subnets must have network ACLs")
 
-		// Get network ACL and verify it has restrictive rules
-		nacl := aws.GetNetworkAclById(t, *subnet.NetworkAclId, "us-east-1")
+		// Verify the network ACL has restrictive rules
 
 		// Should have rules that restrict access
 		assert.NotEmpty(t, nacl.Entries,
@@ -80,50 +90,44 @@ func TestNISTCSFPRAC5(t *testing.T) {
 
 		// Check for overly permissive rules
 		for _, entry := range nacl.Entries {
-			if entry.IpRanges != nil {
-				for _, ipRange := range entry.IpRanges {
-					if *ipRange.CidrIp == "0.0.0.0/0" && *entry.RuleAction == "allow" {
-						// This is acceptable for public subnets on specific ports
-						// but should be flagged for review
-						if entry.FromPort != nil &&
-							(*entry.FromPort == 80 || *entry.FromPort == 443) {
-							t.Logf("REVIEW: Public access allowed to port %d in subnet %s",
-								*entry.FromPort, *subnet.SubnetId)
-						}
-					}
+			if entry.CidrBlock != nil && *entry.CidrBlock == "0.0.0.0/0" && *entry.RuleAction == "allow" {
+				// This is acceptable for public subnets on specific ports
+				// but should be flagged for review
+				if entry.PortRange != nil &&
+					(*entry.PortRange.From == 80 || *entry.PortRange.From == 443) {
+					t.Logf("REVIEW: Public access allowed to port %d in subnet %s",
+						*entry.PortRange.From, *subnet.SubnetId)
 				}
 			}
 		}
 	}
 }
 
-// TestVPC-COMP-003: ISO 27001 A.13.1.1
+var _ = registry.Register(registry.Suite{
+	Name:        "VPC-COMP-003",
+	Description: "ISO 27001 A.13.1.1",
+	Category:    "vpc",
+	Priority:    1,
+	Tags:        []string{registry.TagCompliance},
+	Controls:    []registry.Control{registry.ISO27001A1311},
+	Fixture:     vpctest.Fixture,
+	TestFunc:    TestISO27001A1311,
+})
+
 func TestISO27001A1311(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../terraform/modules/vpc",
-		Vars: map[string]interface{}{
-			"vpc_cidr":           "10.0.0.0/16",
-			"availability_zones": []string{"us-east-1a", "us-east-1b"},
-			"public_subnets":     []string{"10.0.1.0/24", "10.0.2.0/24"},
-			"private_subnets":    []string{"10.0.10.0/24", "10.0.11.0/24"},
-			"environment":        "test",
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	terraformOptions := vpctest.Apply(t, vpctest.TwoZones)
 
 	vpcId := terraform.Output(t, terraformOptions, "vpc_id")
 
 	// ISO 27001 A.13.1.1: Network controls for information transfer
-	vpc := aws.GetVpcById(t, vpcId, "us-east-1")
+	vpc := vpctest.GetVpc(t, vpcId)
 
 	// Verify VPC has proper identification and classification
-	assert.Contains(t, getTagValue(vpc.Tags, "Project"), "aegis-kubernetes-framework",
+	vpctest.AssertTagContains(t, vpc.Tags, "Project", "aegis-kubernetes-framework",
 		"ISO 27001 A.13.1.1: Resources must be properly identified")
-	assert.Contains(t, getTagValue(vpc.Tags, "Environment"), "test",
+	vpctest.AssertTagContains(t, vpc.Tags, "Environment", "test",
 		"ISO 27001 A.13.1.1: Resources must have environment classification")
 
 	// Verify network segmentation
@@ -134,37 +138,31 @@ func TestISO27001A1311(t *testing.T) {
 	assert.NotEmpty(t, privateSubnets, "ISO 27001 A.13.1.1: Private subnets required for internal resources")
 
 	// Verify subnets are in different availability zones for redundancy
-	publicSubnetDetails := aws.GetSubnetsByIds(t, publicSubnets, "us-east-1")
-	azMap := make(map[string]bool)
-	for _, subnet := range publicSubnetDetails {
-		azMap[*subnet.AvailabilityZone] = true
-	}
-	assert.Greater(t, len(azMap), 1,
+	publicSubnetDetails := vpctest.GetSubnetsByIds(t, publicSubnets)
+	vpctest.AssertSpreadAcrossZones(t, publicSubnetDetails, 2,
 		"ISO 27001 A.13.1.1: Resources should be distributed across multiple AZs")
 }
 
-// TestVPC-COMP-004: SOC 2 CC6.1
+var _ = registry.Register(registry.Suite{
+	Name:        "VPC-COMP-004",
+	Description: "SOC 2 CC6.1",
+	Category:    "vpc",
+	Priority:    1,
+	Tags:        []string{registry.TagCompliance},
+	Controls:    []registry.Control{registry.SOC2CC61},
+	Fixture:     vpctest.Fixture,
+	TestFunc:    TestSOC2CC61,
+})
+
 func TestSOC2CC61(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../terraform/modules/vpc",
-		Vars: map[string]interface{}{
-			"vpc_cidr":           "10.0.0.0/16",
-			"availability_zones": []string{"us-east-1a", "us-east-1b"},
-			"public_subnets":     []string{"10.0.1.0/24", "10.0.2.0/24"},
-			"private_subnets":    []string{"10.0.10.0/24", "10.0.11.0/24"},
-			"environment":        "test",
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	terraformOptions := vpctest.Apply(t, vpctest.TwoZones)
 
 	vpcId := terraform.Output(t, terraformOptions, "vpc_id")
 
 	// SOC 2 CC6.1: Logical access security
-	securityGroups := aws.GetSecurityGroupsByVpcId(t, vpcId, "us-east-1")
+	securityGroups := vpctest.GetSecurityGroupsByVpcId(t, vpcId)
 
 	// Verify security groups exist and have restrictive rules
 	assert.NotEmpty(t, securityGroups, "SOC 2 CC6.1: Security groups must exist")
@@ -190,19 +188,9 @@ func TestSOC2CC61(t *testing.T) {
 	}
 
 	// Verify network ACLs provide additional layer of access control
-	subnets := aws.GetSubnetsByVpcId(t, vpcId, "us-east-1")
+	subnets := vpctest.GetSubnetsByVpcId(t, vpcId)
 	for _, subnet := range subnets {
-		assert.NotEmpty(t, subnet.NetworkAclId,
+		assert.NotNil(t, vpctest.GetNetworkAclForSubnet(t, *subnet.SubnetId),
 			"SOC 2 CC6.1: All subnets must have network ACL protection")
 	}
 }
-
-// Helper function to get tag value
-func getTagValue(tags []aws.EC2Tag, key string) string {
-	for _, tag := range tags {
-		if *tag.Key == key {
-			return *tag.Value
-		}
-	}
-	return ""
-}
\ No newline at end of file
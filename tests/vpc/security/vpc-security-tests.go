@@ -4,181 +4,336 @@
 package vpc
 
 import (
+	"fmt"
+	"net/netip"
 	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/gruntwork-io/terratest/modules/terraform"
-	"github.com/gruntwork-io/terratest/modules/aws"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aegis-k8s-framework/ipam"
+	"aegis-k8s-framework/netmodel"
+
+	"aegis-kubernetes-framework/tests/awsenv"
+	"aegis-kubernetes-framework/tests/registry"
+	"aegis-kubernetes-framework/tests/vpc/vpctest"
 )
 
-// TestVPC-SEC-001: Test default security posture
+var _ = registry.RegisterTeardown(registry.Teardown{Fixture: vpctest.Fixture, Func: vpctest.Teardown})
+
+var _ = registry.Register(registry.Suite{
+	Name:        "VPC-SEC-001",
+	Description: "Test default security posture",
+	Category:    "vpc",
+	Priority:    1,
+	Tags:        []string{registry.TagSecurity},
+	Fixture:     vpctest.Fixture,
+	TestFunc:    TestVPCDefaultSecurityPosture,
+})
+
 func TestVPCDefaultSecurityPosture(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../terraform/modules/vpc",
-		Vars: map[string]interface{}{
-			"vpc_cidr":           "10.0.0.0/16",
-			"availability_zones": []string{"us-east-1a", "us-east-1b"},
-			"public_subnets":     []string{"10.0.1.0/24", "10.0.2.0/24"},
-			"private_subnets":    []string{"10.0.10.0/24", "10.0.11.0/24"},
-			"environment":        "test",
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	terraformOptions := vpctest.Apply(t, vpctest.TwoZones)
 
 	vpcId := terraform.Output(t, terraformOptions, "vpc_id")
 	privateSubnetIds := terraform.OutputList(t, terraformOptions, "private_subnet_ids")
 
 	// Verify private subnets have no public IP assignment by default
 	for _, subnetId := range privateSubnetIds {
-		subnet := aws.GetSubnetById(t, subnetId, "us-east-1")
+		subnet := vpctest.GetSubnetById(t, subnetId)
 		assert.False(t, *subnet.MapPublicIpOnLaunch,
 			"Private subnet should not auto-assign public IPs")
 	}
 
 	// Verify VPC has proper tags for security classification
-	vpc := aws.GetVpcById(t, vpcId, "us-east-1")
-	assert.Contains(t, getTagValue(vpc.Tags, "Environment"), "test")
-	assert.Contains(t, getTagValue(vpc.Tags, "Project"), "aegis-kubernetes-framework")
+	vpc := vpctest.GetVpc(t, vpcId)
+	vpctest.AssertTagContains(t, vpc.Tags, "Environment", "test")
+	vpctest.AssertTagContains(t, vpc.Tags, "Project", "aegis-kubernetes-framework")
 }
 
-// TestVPC-SEC-002: Validate network isolation
+var _ = registry.Register(registry.Suite{
+	Name:        "VPC-SEC-002",
+	Description: "Validate network isolation",
+	Category:    "vpc",
+	Priority:    1,
+	Tags:        []string{registry.TagSecurity},
+	Controls:    []registry.Control{registry.NISTCSFPRAC5, registry.SOC2CC61},
+	Fixture:     vpctest.Fixture,
+	TestFunc:    TestVPCNetworkIsolation,
+})
+
 func TestVPCNetworkIsolation(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../terraform/modules/vpc",
-		Vars: map[string]interface{}{
-			"vpc_cidr":           "10.0.0.0/16",
-			"availability_zones": []string{"us-east-1a", "us-east-1b"},
-			"public_subnets":     []string{"10.0.1.0/24", "10.0.2.0/24"},
-			"private_subnets":    []string{"10.0.10.0/24", "10.0.11.0/24"},
-			"environment":        "test",
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	vpcId := terraform.Output(t, terraformOptions, "vpc_id")
+	// The network the module creates with the security groups kops adds for
+	// the cluster, evaluated without an AWS account
+	network, err := netmodel.Generate(vpctest.Model(t, vpctest.TwoZones))
+	require.NoError(t, err)
+	network.SecurityGroups = clusterSecurityGroups()
+
+	t.Run("Reachability", func(t *testing.T) {
+		flows := []struct {
+			name        string
+			source      string
+			sourceGroup string
+			destination string
+			destGroup   string
+			port        int
+			allowed     bool
+			deniedBy    string
+		}{
+			{"API from the internet", "203.0.113.10", "", "10.0.1.10", "sg-masters", 443, true, ""},
+			{"SSH to masters from the internet", "203.0.113.10", "", "10.0.1.10", "sg-masters", 22, false, netmodel.HopNetworkACL},
+			{"SSH to nodes from the internet", "203.0.113.10", "", "10.0.10.10", "sg-nodes", 22, false, netmodel.HopGateway},
+			{"Kubelet from the internet", "203.0.113.10", "", "10.0.11.10", "sg-nodes", 10250, false, netmodel.HopGateway},
+			{"Kubelet from masters", "10.0.1.10", "sg-masters", "10.0.11.10", "sg-nodes", 10250, true, ""},
+			{"Kubelet from outside the cluster", "10.0.2.20", "sg-other", "10.0.10.10", "sg-nodes", 10250, false, netmodel.HopSecurityGroup},
+			{"Nodes to HTTPS on the internet", "10.0.10.10", "sg-nodes", "198.51.100.1", "", 443, true, ""},
+			{"Nodes to databases on the internet", "10.0.10.10", "sg-nodes", "198.51.100.1", "", 5432, false, netmodel.HopNetworkACL},
+		}
+		for _, f := range flows {
+			t.Run(f.name, func(t *testing.T) {
+				flow := netmodel.Flow{
+					Source:      netip.MustParseAddr(f.source),
+					Destination: netip.MustParseAddr(f.destination),
+					Protocol:    netmodel.ProtocolTCP,
+					Port:        f.port,
+				}
+				if f.sourceGroup != "" {
+					flow.SourceGroups = []string{f.sourceGroup}
+				}
+				if f.destGroup != "" {
+					flow.DestinationGroups = []string{f.destGroup}
+				}
 
-	// Verify no security groups allow unrestricted access
-	securityGroups := aws.GetSecurityGroupsByVpcId(t, vpcId, "us-east-1")
-
-	for _, sg := range securityGroups {
-		for _, permission := range sg.IpPermissions {
-			// Check for overly permissive rules (0.0.0.0/0)
-			if permission.IpRanges != nil {
-				for _, ipRange := range permission.IpRanges {
-					if *ipRange.CidrIp == "0.0.0.0/0" {
-						// Allow HTTP/HTTPS for public subnets, but flag for review
-						if permission.FromPort != nil &&
-							(*permission.FromPort == 80 || *permission.FromPort == 443) {
-							t.Logf("WARNING: Security group %s allows public access to port %d",
-								*sg.GroupId, *permission.FromPort)
-						} else {
-							t.Errorf("SECURITY RISK: Security group %s allows unrestricted access to port %d",
-								*sg.GroupId, *permission.FromPort)
+				trace := network.Trace(flow)
+				require.Equal(t, f.allowed, trace.Allowed, trace.String())
+				if !f.allowed {
+					assert.Equal(t, f.deniedBy, trace.Hops[len(trace.Hops)-1].Kind, trace.String())
+				}
+			})
+		}
+	})
+
+	t.Run("Applied security groups", func(t *testing.T) {
+		terraformOptions := vpctest.Apply(t, vpctest.TwoZones)
+
+		vpcId := terraform.Output(t, terraformOptions, "vpc_id")
+
+		// Verify no security groups allow unrestricted access
+		securityGroups := vpctest.GetSecurityGroupsByVpcId(t, vpcId)
+
+		for _, sg := range securityGroups {
+			for _, permission := range sg.IpPermissions {
+				// Check for overly permissive rules (0.0.0.0/0)
+				if permission.IpRanges != nil {
+					for _, ipRange := range permission.IpRanges {
+						if *ipRange.CidrIp == "0.0.0.0/0" {
+							// Allow HTTP/HTTPS for public subnets, but flag for review
+							if permission.FromPort != nil &&
+								(*permission.FromPort == 80 || *permission.FromPort == 443) {
+								t.Logf("WARNING: Security group %s allows public access to port %d",
+									*sg.GroupId, *permission.FromPort)
+							} else {
+								t.Errorf("SECURITY RISK: Security group %s allows unrestricted access to port %d",
+									*sg.GroupId, *permission.FromPort)
+							}
 						}
 					}
 				}
 			}
 		}
+	})
+}
+
+// clusterSecurityGroups models the security groups kops creates for the
+// cluster template: API and SSH access from anywhere (kubernetesApiAccess and
+// sshAccess), and all traffic between masters and nodes.
+func clusterSecurityGroups() []netmodel.SecurityGroup {
+	cluster := []netmodel.SecurityGroupRule{
+		{Protocol: netmodel.ProtocolAll, SourceGroup: "sg-masters"},
+		{Protocol: netmodel.ProtocolAll, SourceGroup: "sg-nodes"},
+	}
+	ssh := netmodel.SecurityGroupRule{Protocol: netmodel.ProtocolTCP, PortRange: "22", CidrBlock: "0.0.0.0/0"}
+	return []netmodel.SecurityGroup{
+		{
+			ID:      "sg-masters",
+			Ingress: append([]netmodel.SecurityGroupRule{{Protocol: netmodel.ProtocolTCP, PortRange: "443", CidrBlock: "0.0.0.0/0"}, ssh}, cluster...),
+			Egress:  []netmodel.SecurityGroupRule{netmodel.AllowAllEgress},
+		},
+		{
+			ID:      "sg-nodes",
+			Ingress: append([]netmodel.SecurityGroupRule{ssh}, cluster...),
+			Egress:  []netmodel.SecurityGroupRule{netmodel.AllowAllEgress},
+		},
+		{
+			ID:     "sg-other",
+			Egress: []netmodel.SecurityGroupRule{netmodel.AllowAllEgress},
+		},
 	}
 }
 
-// TestVPC-SEC-003: Test NACL rule enforcement
+var _ = registry.Register(registry.Suite{
+	Name:        "VPC-SEC-003",
+	Description: "Test NACL rule enforcement",
+	Category:    "vpc",
+	Priority:    1,
+	Tags:        []string{registry.TagSecurity},
+	Controls:    []registry.Control{registry.NISTCSFPRAC5, registry.SOC2CC61},
+	Fixture:     vpctest.Fixture,
+	TestFunc:    TestVPCNACLRules,
+})
+
 func TestVPCNACLRules(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../terraform/modules/vpc",
-		Vars: map[string]interface{}{
-			"vpc_cidr":           "10.0.0.0/16",
-			"availability_zones": []string{"us-east-1a", "us-east-1b"},
-			"public_subnets":     []string{"10.0.1.0/24", "10.0.2.0/24"},
-			"private_subnets":    []string{"10.0.10.0/24", "10.0.11.0/24"},
-			"environment":        "test",
-		},
-	}
+	// The network ACLs the module creates, evaluated without an AWS account
+	model := vpctest.Model(t, vpctest.TwoZones)
+	nacls, err := netmodel.GenerateNACLs(model)
+	require.NoError(t, err)
+
+	t.Run("Generated rules", func(t *testing.T) {
+		for _, subnet := range model.Subnets {
+			nacl, ok := netmodel.NACLFor(nacls, subnet.ID)
+			require.True(t, ok, "Subnet %s should have a network ACL", subnet.ID)
+
+			// Check for deny-all rules at the end (rule number should be high)
+			for _, direction := range []string{netmodel.DirectionIngress, netmodel.DirectionEgress} {
+				rule, allowed := nacl.Evaluate(direction, netip.MustParseAddr("203.0.113.10"), netmodel.ProtocolUDP, 53)
+				assert.False(t, allowed, "%s should deny %s UDP from the internet", nacl.ID, direction)
+				assert.True(t, rule.RuleNumber > 9000 && rule.RuleAction == netmodel.ActionDeny,
+					"Network ACL %s should have a %s deny-all rule with high rule number, got %s", nacl.ID, direction, rule)
+			}
+		}
+	})
+
+	t.Run("Enforcement", func(t *testing.T) {
+		flows := []struct {
+			source      string
+			destination string
+			port        int
+			allowed     bool
+		}{
+			{"203.0.113.10", "10.0.1.10", 443, true},    // Internet to load balancers
+			{"203.0.113.10", "10.0.1.10", 22, false},    // No SSH from the internet
+			{"203.0.113.10", "10.0.10.10", 22, false},   // Private subnets are not reachable
+			{"203.0.113.10", "10.0.10.10", 443, false},  // not even on HTTPS
+			{"10.0.10.10", "198.51.100.1", 443, true},   // Private subnets reach HTTPS through NAT
+			{"10.0.10.10", "198.51.100.1", 5432, false}, // but nothing else
+			{"10.0.1.10", "10.0.11.10", 10250, true},    // Anything within the VPC
+		}
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+		// The same flows against the ACLs in the plan of the module
+		planned, err := netmodel.LoadTerraformFile("../testdata/plan.json")
+		require.NoError(t, err)
+
+		for _, network := range []netmodel.Network{{VPC: model, NACLs: nacls}, planned} {
+			for _, f := range flows {
+				flow := netmodel.Flow{
+					Source:      netip.MustParseAddr(f.source),
+					Destination: netip.MustParseAddr(f.destination),
+					Protocol:    netmodel.ProtocolTCP,
+					Port:        f.port,
+				}
+				decisions, allowed := netmodel.EvaluateFlow(network.VPC, network.NACLs, flow)
+				assert.Equal(t, f.allowed, allowed, "%s: %v", flow, decisions)
+			}
+		}
+	})
 
-	vpcId := terraform.Output(t, terraformOptions, "vpc_id")
+	t.Run("Applied rules", func(t *testing.T) {
+		terraformOptions := vpctest.Apply(t, vpctest.TwoZones)
 
-	// Get all subnets
-	subnets := aws.GetSubnetsByVpcId(t, vpcId, "us-east-1")
+		vpcId := terraform.Output(t, terraformOptions, "vpc_id")
 
-	// Verify each subnet has a network ACL
-	for _, subnet := range subnets {
-		assert.NotEmpty(t, subnet.NetworkAclId,
-			"Subnet %s should have a network ACL", *subnet.SubnetId)
+		// Get all subnets
+		subnets := vpctest.GetSubnetsByVpcId(t, vpcId)
 
-		// Get network ACL details
-		nacl := aws.GetNetworkAclById(t, *subnet.NetworkAclId, "us-east-1")
+		// Verify each subnet has the network ACL of its tier
+		for _, subnet := range subnets {
+			nacl := vpctest.GetNetworkAclForSubnet(t, *subnet.SubnetId)
+			require.NotNil(t, nacl,
+				"Subnet %s should have a network ACL", *subnet.SubnetId)
 
-		// Verify NACL has both ingress and egress rules
-		assert.NotEmpty(t, nacl.Entries, "Network ACL should have rules")
+			tier := ipam.Tier(vpctest.GetTagValue(subnet.Tags, "Type"))
+			expected, err := netmodel.GenerateNACLRules(model, tier)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, expected, naclRules(nacl),
+				"Network ACL of %s subnet %s should match the generated rules", tier, *subnet.SubnetId)
+		}
+	})
+}
 
-		// Check for deny-all rule at the end (rule number should be high)
-		hasDenyAll := false
-		for _, entry := range nacl.Entries {
-			if *entry.RuleNumber > 9000 && *entry.RuleAction == "deny" {
-				hasDenyAll = true
-				break
+// naclRules converts the entries of an applied network ACL, leaving out the
+// implicit rule AWS adds to every ACL.
+func naclRules(nacl *ec2.NetworkAcl) []netmodel.NACLRule {
+	var rules []netmodel.NACLRule
+	for _, entry := range nacl.Entries {
+		if *entry.RuleNumber == netmodel.ImplicitRuleNumber {
+			continue
+		}
+		rule := netmodel.NACLRule{
+			RuleNumber: int(*entry.RuleNumber),
+			Protocol:   netmodel.NormalizeProtocol(*entry.Protocol),
+			CidrBlock:  awssdk.StringValue(entry.CidrBlock),
+			RuleAction: *entry.RuleAction,
+			Direction:  netmodel.DirectionIngress,
+		}
+		if *entry.Egress {
+			rule.Direction = netmodel.DirectionEgress
+		}
+		if entry.PortRange != nil {
+			rule.PortRange = fmt.Sprintf("%d-%d", *entry.PortRange.From, *entry.PortRange.To)
+			if *entry.PortRange.From == *entry.PortRange.To {
+				rule.PortRange = fmt.Sprint(*entry.PortRange.From)
 			}
 		}
-		assert.True(t, hasDenyAll,
-			"Network ACL should have a deny-all rule with high rule number")
+		rules = append(rules, rule)
 	}
+	return rules
 }
 
-// TestVPC-SEC-004: Validate VPC flow logs
+var _ = registry.Register(registry.Suite{
+	Name:        "VPC-SEC-004",
+	Description: "Validate VPC flow logs",
+	Category:    "vpc",
+	Priority:    1,
+	Tags:        []string{registry.TagSecurity},
+	Controls:    []registry.Control{registry.CISAWS31},
+	Fixture:     vpctest.Fixture,
+	TestFunc:    TestVPCFlowLogs,
+})
+
 func TestVPCFlowLogs(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../terraform/modules/vpc",
-		Vars: map[string]interface{}{
-			"vpc_cidr":           "10.0.0.0/16",
-			"availability_zones": []string{"us-east-1a", "us-east-1b"},
-			"public_subnets":     []string{"10.0.1.0/24", "10.0.2.0/24"},
-			"private_subnets":    []string{"10.0.10.0/24", "10.0.11.0/24"},
-			"environment":        "test",
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	terraformOptions := vpctest.Apply(t, vpctest.TwoZones)
 
 	vpcId := terraform.Output(t, terraformOptions, "vpc_id")
 
 	// Check if VPC flow logs are enabled
-	flowLogs := aws.GetVpcFlowLogs(t, vpcId, "us-east-1")
+	flowLogs := vpctest.GetVpcFlowLogs(t, vpcId)
 
 	// Should have at least one flow log enabled
 	assert.NotEmpty(t, flowLogs, "VPC should have flow logs enabled")
 
 	// Verify flow log configuration
 	for _, flowLog := range flowLogs {
-		assert.Equal(t, "ACTIVE", *flowLog.FlowLogStatus,
-			"Flow log should be active")
-
 		// Verify traffic type includes all traffic
 		assert.Contains(t, []string{"ALL", "ACCEPT", "REJECT"},
 			*flowLog.TrafficType, "Flow log should capture all traffic types")
 	}
-}
 
-// Helper function to get tag value
-func getTagValue(tags []aws.EC2Tag, key string) string {
-	for _, tag := range tags {
-		if *tag.Key == key {
-			return *tag.Value
+	t.Run("Delivery", func(t *testing.T) {
+		awsenv.SkipOnEmulator(t, "the emulator stores flow logs but never captures or delivers traffic, so their status does not show delivery works")
+
+		for _, flowLog := range flowLogs {
+			assert.Equal(t, "ACTIVE", *flowLog.FlowLogStatus,
+				"Flow log should be active")
 		}
-	}
-	return ""
-}
\ No newline at end of file
+	})
+}
@@ -0,0 +1,124 @@
+package vpctest
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aegis-kubernetes-framework/tests/awsenv"
+)
+
+// EC2 lookups that the terratest aws module does not provide. They query the
+// region the fixtures are applied in, on the emulator when there is one.
+
+var filterVpcId = "vpc-id"
+
+func GetVpc(t *testing.T, vpcId string) *ec2.Vpc {
+	output, err := awsenv.EC2Client(t, awsenv.Region()).DescribeVpcs(&ec2.DescribeVpcsInput{
+		VpcIds: []*string{&vpcId},
+	})
+	require.NoError(t, err)
+	require.Len(t, output.Vpcs, 1)
+	return output.Vpcs[0]
+}
+
+func GetSubnetsByIds(t *testing.T, subnetIds []string) []*ec2.Subnet {
+	ids := make([]*string, len(subnetIds))
+	for i := range subnetIds {
+		ids[i] = &subnetIds[i]
+	}
+	output, err := awsenv.EC2Client(t, awsenv.Region()).DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: ids})
+	require.NoError(t, err)
+	return output.Subnets
+}
+
+func GetSubnetById(t *testing.T, subnetId string) *ec2.Subnet {
+	subnets := GetSubnetsByIds(t, []string{subnetId})
+	require.Len(t, subnets, 1)
+	return subnets[0]
+}
+
+func GetSubnetsByVpcId(t *testing.T, vpcId string) []*ec2.Subnet {
+	output, err := awsenv.EC2Client(t, awsenv.Region()).DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{{Name: &filterVpcId, Values: []*string{&vpcId}}},
+	})
+	require.NoError(t, err)
+	return output.Subnets
+}
+
+func GetSecurityGroupsByVpcId(t *testing.T, vpcId string) []*ec2.SecurityGroup {
+	output, err := awsenv.EC2Client(t, awsenv.Region()).DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{{Name: &filterVpcId, Values: []*string{&vpcId}}},
+	})
+	require.NoError(t, err)
+	return output.SecurityGroups
+}
+
+// GetNetworkAclForSubnet returns the network ACL associated with the subnet,
+// or nil if there is none.
+func GetNetworkAclForSubnet(t *testing.T, subnetId string) *ec2.NetworkAcl {
+	filterName := "association.subnet-id"
+	output, err := awsenv.EC2Client(t, awsenv.Region()).DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{
+		Filters: []*ec2.Filter{{Name: &filterName, Values: []*string{&subnetId}}},
+	})
+	require.NoError(t, err)
+	if len(output.NetworkAcls) == 0 {
+		return nil
+	}
+	return output.NetworkAcls[0]
+}
+
+func GetVpcFlowLogs(t *testing.T, vpcId string) []*ec2.FlowLog {
+	filterName := "resource-id"
+	output, err := awsenv.EC2Client(t, awsenv.Region()).DescribeFlowLogs(&ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{{Name: &filterName, Values: []*string{&vpcId}}},
+	})
+	require.NoError(t, err)
+	return output.FlowLogs
+}
+
+func GetNatGateway(t *testing.T, natGatewayId string) *ec2.NatGateway {
+	output, err := awsenv.EC2Client(t, awsenv.Region()).DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+		NatGatewayIds: []*string{&natGatewayId},
+	})
+	require.NoError(t, err)
+	require.Len(t, output.NatGateways, 1)
+	return output.NatGateways[0]
+}
+
+func GetRouteTablesByVpcId(t *testing.T, vpcId string) []*ec2.RouteTable {
+	output, err := awsenv.EC2Client(t, awsenv.Region()).DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{{Name: &filterVpcId, Values: []*string{&vpcId}}},
+	})
+	require.NoError(t, err)
+	return output.RouteTables
+}
+
+// GetTagValue returns the value of the tag key, or "" if there is none.
+func GetTagValue(tags []*ec2.Tag, key string) string {
+	for _, tag := range tags {
+		if *tag.Key == key {
+			return *tag.Value
+		}
+	}
+	return ""
+}
+
+// Assertions shared by the suites
+
+// AssertTagContains checks that the tag key of a resource contains value.
+func AssertTagContains(t *testing.T, tags []*ec2.Tag, key, value string, msgAndArgs ...interface{}) bool {
+	return assert.Contains(t, GetTagValue(tags, key), value, msgAndArgs...)
+}
+
+// AssertSpreadAcrossZones checks that subnets are in at least zones
+// distinct availability zones.
+func AssertSpreadAcrossZones(t *testing.T, subnets []*ec2.Subnet, zones int, msgAndArgs ...interface{}) bool {
+	distinct := make(map[string]bool)
+	for _, subnet := range subnets {
+		distinct[*subnet.AvailabilityZone] = true
+	}
+	return assert.GreaterOrEqual(t, len(distinct), zones, msgAndArgs...)
+}
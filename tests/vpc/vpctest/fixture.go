@@ -0,0 +1,170 @@
+// VPC Test Fixtures
+// terraform/modules/vpc fixtures shared by the VPC integration, security and
+// compliance suites: the scenarios they apply, a single apply per package
+// cached between suites in test stages, and the teardown the runner calls
+// once the suites of a package have run
+
+package vpctest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"aegis-k8s-framework/netmodel"
+
+	"aegis-kubernetes-framework/tests/awsenv"
+)
+
+// Fixture is the fixture every suite applying the module registers. Suites
+// sharing it run one after another, and the runner tears down the fixtures
+// of a package after the last of its suites, so the account only holds the
+// VPCs of one package at a time.
+const Fixture = "terraform/modules/vpc"
+
+// moduleDir is the module relative to the package directories of the VPC
+// suites, which the runner runs them from
+const moduleDir = "../../../" + Fixture
+
+// VPCCIDR is the address range of the VPC in every scenario
+const VPCCIDR = "10.0.0.0/16"
+
+// Scenario is a configuration of the module the suites apply
+type Scenario struct {
+	Name           string
+	PublicSubnets  []string
+	PrivateSubnets []string
+}
+
+// Scenarios applied by the suites; each has one public and one private
+// subnet per availability zone
+var (
+	TwoZones = Scenario{
+		Name:           "two-zones",
+		PublicSubnets:  []string{"10.0.1.0/24", "10.0.2.0/24"},
+		PrivateSubnets: []string{"10.0.10.0/24", "10.0.11.0/24"},
+	}
+	ThreeZones = Scenario{
+		Name:           "three-zones",
+		PublicSubnets:  []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"},
+		PrivateSubnets: []string{"10.0.10.0/24", "10.0.11.0/24", "10.0.12.0/24"},
+	}
+)
+
+// Options returns the terraform options of scenario in the module
+// directory. The environment, which prefixes the name of every resource,
+// is unique so that runs in parallel, from other checkouts or CI jobs,
+// never collide.
+func Options(t *testing.T, scenario Scenario) *terraform.Options {
+	return &terraform.Options{
+		TerraformDir: moduleDir,
+		Vars: map[string]interface{}{
+			"vpc_cidr":           VPCCIDR,
+			"availability_zones": awsenv.AvailabilityZones(t, len(scenario.PublicSubnets)),
+			"public_subnets":     scenario.PublicSubnets,
+			"private_subnets":    scenario.PrivateSubnets,
+			"environment":        "test-" + strings.ToLower(random.UniqueId()),
+		},
+	}
+}
+
+// Environment returns the environment options were applied with.
+func Environment(options *terraform.Options) string {
+	return options.Vars["environment"].(string)
+}
+
+// Model returns the network model of the VPC the module creates for
+// scenario, for the checks that need no AWS account.
+func Model(t *testing.T, scenario Scenario) netmodel.VPC {
+	vpc, err := netmodel.ModuleVPC(
+		VPCCIDR,
+		awsenv.AvailabilityZones(t, len(scenario.PublicSubnets)),
+		scenario.PublicSubnets,
+		scenario.PrivateSubnets,
+	)
+	require.NoError(t, err)
+	return vpc
+}
+
+// fixtureState is what the suites of a package share about an applied
+// scenario, saved as test data in the package directory
+type fixtureState struct {
+	Options *terraform.Options
+	Applied bool
+}
+
+// Apply applies scenario from a temporary copy of the module, or returns the
+// options of the copy an earlier suite of the package already applied. The
+// copy is destroyed by Teardown. Set SKIP_setup to only use a fixture that
+// is already applied, and SKIP_teardown to keep the fixture for the next
+// run. The test is skipped unless fixtures may be applied; see
+// awsenv.SkipWithoutAWS.
+func Apply(t *testing.T, scenario Scenario) *terraform.Options {
+	t.Helper()
+	awsenv.SkipWithoutAWS(t)
+
+	path := testDataPath(scenario.Name)
+	runStage(t, "setup", func() {
+		var state fixtureState
+		if !loadTestData(t, path, &state) {
+			dir, err := files.CopyTerraformFolderToTemp(moduleDir, "aegis-vpc-"+scenario.Name)
+			require.NoError(t, err)
+			state.Options = Options(t, scenario)
+			state.Options.TerraformDir = dir
+			awsenv.Configure(t, state.Options)
+
+			// Saved before applying, so that Teardown destroys whatever a
+			// failed apply left behind
+			saveTestData(t, path, state)
+		}
+		if state.Applied {
+			return
+		}
+
+		terraform.InitAndApply(t, state.Options)
+		state.Applied = true
+		saveTestData(t, path, state)
+	})
+
+	var state fixtureState
+	require.True(t, loadTestData(t, path, &state), "Fixture %s has not been applied; unset SKIP_setup", scenario.Name)
+	require.True(t, state.Applied, "Fixture %s did not finish applying; unset SKIP_setup", scenario.Name)
+	return state.Options
+}
+
+// Teardown destroys every scenario applied from the package directory and
+// removes its copy of the module. Register it for Fixture in each package
+// that calls Apply.
+func Teardown(t *testing.T) {
+	paths, err := filepath.Glob(testDataPath("*"))
+	require.NoError(t, err)
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			runStage(t, "teardown", func() {
+				var state fixtureState
+				if !loadTestData(t, path, &state) || state.Options == nil {
+					t.Fatalf("%s does not hold a fixture", path)
+				}
+
+				// A fixture whose apply never got as far as creating
+				// resources has no state to destroy
+				if files.FileExists(filepath.Join(state.Options.TerraformDir, "terraform.tfstate")) {
+					terraform.Destroy(t, state.Options)
+				}
+				// The module is copied into a temporary directory of its own
+				require.NoError(t, os.RemoveAll(filepath.Dir(state.Options.TerraformDir)),
+					"Removing the module copy of %s", name)
+				require.NoError(t, os.Remove(path))
+			})
+		})
+	}
+	os.Remove(filepath.Dir(testDataPath("*"))) // Only once it is empty
+}
@@ -0,0 +1,59 @@
+package vpctest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test stages follow the conventions of terratest's test_structure: a stage
+// is skipped when SKIP_<stage> is set, and data shared between stages is
+// saved as JSON in the .test-data directory of the test folder. The package
+// itself is not used because it pulls in terratest's Kubernetes module.
+
+// runStage runs stage unless SKIP_<name> is set.
+func runStage(t *testing.T, name string, stage func()) {
+	if os.Getenv("SKIP_"+name) != "" {
+		t.Logf("SKIP_%s is set, so skipping stage %s", name, name)
+		return
+	}
+	stage()
+}
+
+// testDataPath returns where name is saved in the package directory.
+func testDataPath(name string) string {
+	return filepath.Join(".test-data", name+".json")
+}
+
+// saveTestData saves value at path, replacing what is there.
+func saveTestData(t *testing.T, path string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Cannot encode test data for %s: %v", path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Cannot create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Cannot save test data to %s: %v", path, err)
+	}
+}
+
+// loadTestData loads the value saved at path into value and reports whether
+// there was one.
+func loadTestData(t *testing.T, path string, value interface{}) bool {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		t.Fatalf("Cannot load test data from %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		t.Fatalf("Cannot parse test data in %s: %v", path, err)
+	}
+	return true
+}